@@ -0,0 +1,194 @@
+// Package auth concentra a emissão e a validação dos JWTs da API.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Tipos de token. Um token só é aceito no fluxo do seu tipo.
+const (
+	TokenTypeAccess = "access"
+	// Emitido pelo login quando a conta tem verificação em duas etapas; só serve
+	// para concluir o login com o código do autenticador.
+	TokenTypeTwoFactor = "2fa_challenge"
+)
+
+const defaultKeyID = "default"
+
+var (
+	ErrInvalidToken   = errors.New("token inválido")
+	ErrExpiredToken   = errors.New("token expirado")
+	ErrWrongTokenType = errors.New("tipo de token inválido")
+)
+
+// Claims são as informações carregadas nos tokens da API.
+type Claims struct {
+	jwt.RegisteredClaims
+	UserID      uuid.UUID `json:"user_id"`
+	IsAdmin     bool      `json:"is_admin,omitempty"`
+	Permissions []string  `json:"permissions,omitempty"`
+	SessionID   string    `json:"sid,omitempty"`
+	TokenType   string    `json:"typ"`
+
+	// Admin que ainda precisa ativar a verificação em duas etapas exigida pela
+	// configuração; até lá, só acessa as rotas de configuração do segundo fator.
+	TwoFactorSetupRequired bool `json:"2fa_setup,omitempty"`
+}
+
+type keySet struct {
+	keys     map[string][]byte
+	activeID string
+}
+
+var (
+	loadKeysOnce sync.Once
+	keys         keySet
+	keysErr      error
+)
+
+// loadKeys lê as chaves de assinatura na primeira utilização (depois do .env ser carregado).
+// JWT_KEYS traz as chaves no formato "kid1:segredo1,kid2:segredo2" e JWT_ACTIVE_KID
+// indica qual assina os novos tokens; as demais continuam valendo para validação,
+// o que permite trocar a chave sem derrubar as sessões. Sem JWT_KEYS, usa JWT_SECRET.
+func loadKeys() (keySet, error) {
+	loadKeysOnce.Do(func() {
+		set := keySet{keys: make(map[string][]byte)}
+		for _, entry := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			kid, secret, ok := strings.Cut(entry, ":")
+			if !ok || kid == "" || secret == "" {
+				keysErr = fmt.Errorf("JWT_KEYS mal formatado: use kid:segredo")
+				return
+			}
+			set.keys[kid] = []byte(secret)
+		}
+		if secret := os.Getenv("JWT_SECRET"); secret != "" {
+			if _, exists := set.keys[defaultKeyID]; !exists {
+				set.keys[defaultKeyID] = []byte(secret)
+			}
+		}
+
+		set.activeID = os.Getenv("JWT_ACTIVE_KID")
+		if set.activeID == "" {
+			set.activeID = defaultKeyID
+		}
+		if _, ok := set.keys[set.activeID]; !ok {
+			keysErr = fmt.Errorf("chave JWT ativa %q não configurada", set.activeID)
+			return
+		}
+		keys = set
+	})
+	return keys, keysErr
+}
+
+// CheckConfig valida a configuração das chaves; usado na inicialização.
+func CheckConfig() error {
+	_, err := loadKeys()
+	return err
+}
+
+// DerivedKey deriva da chave JWT ativa uma chave para outro uso (ex.: assinar os
+// QR Codes rotativos), sem reaproveitar a chave de assinatura em si.
+func DerivedKey(purpose string) ([]byte, error) {
+	set, err := loadKeys()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, set.keys[set.activeID])
+	mac.Write([]byte("checkinfp:" + purpose))
+	return mac.Sum(nil), nil
+}
+
+func issuer() string {
+	if value := os.Getenv("JWT_ISSUER"); value != "" {
+		return value
+	}
+	return "checkinfp"
+}
+
+func audience() string {
+	if value := os.Getenv("JWT_AUDIENCE"); value != "" {
+		return value
+	}
+	return "checkinfp-api"
+}
+
+// Issue assina um token do tipo informado, válido por ttl. Emissor, audiência,
+// jti e datas são preenchidos aqui.
+func Issue(claims Claims, tokenType string, ttl time.Duration) (string, time.Time, error) {
+	set, err := loadKeys()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiration := now.Add(ttl)
+	claims.TokenType = tokenType
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    issuer(),
+		Subject:   claims.UserID.String(),
+		Audience:  jwt.ClaimStrings{audience()},
+		ExpiresAt: jwt.NewNumericDate(expiration),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        uuid.NewString(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = set.activeID
+	signed, err := token.SignedString(set.keys[set.activeID])
+	return signed, expiration, err
+}
+
+// Parse valida assinatura (somente HS256), emissor, audiência, validade e tipo do token.
+func Parse(tokenString string, tokenType string) (*Claims, error) {
+	set, err := loadKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	_, err = jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = defaultKeyID
+		}
+		key, ok := set.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("chave %q desconhecida", kid)
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer()),
+		jwt.WithAudience(audience()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if claims.TokenType != tokenType {
+		return nil, ErrWrongTokenType
+	}
+	if claims.UserID == uuid.Nil {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
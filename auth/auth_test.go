@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// useKeys troca a configuração das chaves e descarta as carregadas antes.
+func useKeys(t *testing.T, jwtKeys, activeKID string) {
+	t.Helper()
+	t.Setenv("JWT_KEYS", jwtKeys)
+	t.Setenv("JWT_ACTIVE_KID", activeKID)
+	t.Setenv("JWT_SECRET", "")
+	resetKeys := func() {
+		loadKeysOnce = sync.Once{}
+		keys = keySet{}
+		keysErr = nil
+	}
+	resetKeys()
+	t.Cleanup(resetKeys)
+}
+
+// sign assina claims válidas de access token com o método, a chave e o kid informados.
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, edit func(*Claims)) string {
+	t.Helper()
+	now := time.Now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer(),
+			Audience:  jwt.ClaimStrings{audience()},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		UserID:    uuid.New(),
+		TokenType: TokenTypeAccess,
+	}
+	if edit != nil {
+		edit(&claims)
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestParseKeyRotation(t *testing.T) {
+	useKeys(t, "old:segredo-antigo,new:segredo-novo", "new")
+
+	issued, _, err := Issue(Claims{UserID: uuid.New()}, TokenTypeAccess, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := headerKID(t, issued); kid != "new" {
+		t.Errorf("token emitido com kid %q, esperado \"new\"", kid)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"chave ativa", issued, nil},
+		{"chave antiga ainda configurada", sign(t, jwt.SigningMethodHS256, "old", []byte("segredo-antigo"), nil), nil},
+		{"kid desconhecido", sign(t, jwt.SigningMethodHS256, "outro", []byte("segredo-novo"), nil), ErrInvalidToken},
+		{"sem kid e sem chave default", sign(t, jwt.SigningMethodHS256, "", []byte("segredo-novo"), nil), ErrInvalidToken},
+		{"kid de uma chave com outro segredo", sign(t, jwt.SigningMethodHS256, "old", []byte("segredo-novo"), nil), ErrInvalidToken},
+		{"HS512", sign(t, jwt.SigningMethodHS512, "new", []byte("segredo-novo"), nil), ErrInvalidToken},
+		{"alg none", sign(t, jwt.SigningMethodNone, "new", jwt.UnsafeAllowNoneSignatureType, nil), ErrInvalidToken},
+		{"emissor errado", sign(t, jwt.SigningMethodHS256, "new", []byte("segredo-novo"), func(c *Claims) { c.Issuer = "outro" }), ErrInvalidToken},
+		{"audiência errada", sign(t, jwt.SigningMethodHS256, "new", []byte("segredo-novo"), func(c *Claims) { c.Audience = jwt.ClaimStrings{"outra"} }), ErrInvalidToken},
+		{"sem validade", sign(t, jwt.SigningMethodHS256, "new", []byte("segredo-novo"), func(c *Claims) { c.ExpiresAt = nil }), ErrInvalidToken},
+		{"expirado", sign(t, jwt.SigningMethodHS256, "new", []byte("segredo-novo"), func(c *Claims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}), ErrExpiredToken},
+		{"sem usuário", sign(t, jwt.SigningMethodHS256, "new", []byte("segredo-novo"), func(c *Claims) { c.UserID = uuid.Nil }), ErrInvalidToken},
+		{"tipo errado", sign(t, jwt.SigningMethodHS256, "new", []byte("segredo-novo"), func(c *Claims) { c.TokenType = TokenTypeTwoFactor }), ErrWrongTokenType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.token, TokenTypeAccess); !errors.Is(err, tt.err) {
+				t.Errorf("Parse = %v, esperado %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseRetiredKey(t *testing.T) {
+	useKeys(t, "old:segredo-antigo,new:segredo-novo", "old")
+	token, _, err := Issue(Claims{UserID: uuid.New()}, TokenTypeAccess, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Depois da troca, a chave antiga continua configurada: o token segue válido
+	useKeys(t, "old:segredo-antigo,new:segredo-novo", "new")
+	if _, err := Parse(token, TokenTypeAccess); err != nil {
+		t.Errorf("token da chave anterior recusado durante a troca: %v", err)
+	}
+
+	// Retirada a chave antiga do JWT_KEYS, o token deixa de valer
+	useKeys(t, "new:segredo-novo", "new")
+	if _, err := Parse(token, TokenTypeAccess); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token de chave retirada = %v, esperado ErrInvalidToken", err)
+	}
+}
+
+func TestLoadKeysConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		jwtKeys   string
+		activeKID string
+		secret    string
+		ok        bool
+	}{
+		{"só JWT_SECRET", "", "", "segredo", true},
+		{"JWT_KEYS com kid ativo", "a:1,b:2", "b", "", true},
+		{"kid ativo ausente", "a:1", "b", "", false},
+		{"JWT_KEYS sem kid ativo nem JWT_SECRET", "a:1", "", "", false},
+		{"JWT_KEYS mal formatado", "a1", "a", "", false},
+		{"segredo vazio", "a:", "a", "", false},
+		{"nada configurado", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKeys(t, tt.jwtKeys, tt.activeKID)
+			t.Setenv("JWT_SECRET", tt.secret)
+			if err := CheckConfig(); (err == nil) != tt.ok {
+				t.Errorf("CheckConfig = %v, esperado ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func headerKID(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+type systemRoleInput struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Permissions *[]string `json:"permissions"`
+}
+
+func validPermissions(permissions []string) bool {
+	for _, p := range permissions {
+		if !models.ValidPermission(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListSystemRoles lista os papéis de sistema e as permissões disponíveis.
+func ListSystemRoles(c *gin.Context, db *gorm.DB) {
+	var roles []models.SystemRole
+	if err := db.Order("name ASC").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar papéis"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"roles":       roles,
+		"permissions": models.AllPermissions,
+	})
+}
+
+func CreateSystemRole(c *gin.Context, db *gorm.DB) {
+	var input systemRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Name == nil || strings.TrimSpace(*input.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	role := models.SystemRole{Name: strings.TrimSpace(*input.Name), Permissions: models.RolesArray{}}
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+	if input.Permissions != nil {
+		if !validPermissions(*input.Permissions) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Permissão inválida"})
+			return
+		}
+		role.Permissions = *input.Permissions
+	}
+
+	if err := db.Create(&role).Error; err != nil {
+		if utils.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Já existe um papel com esse nome"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao cadastrar papel"})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+func UpdateSystemRole(c *gin.Context, db *gorm.DB) {
+	var role models.SystemRole
+	if err := db.First(&role, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Papel não encontrado"})
+		return
+	}
+
+	var input systemRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	if input.Name != nil {
+		if strings.TrimSpace(*input.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+			return
+		}
+		role.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+	if input.Permissions != nil {
+		if !validPermissions(*input.Permissions) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Permissão inválida"})
+			return
+		}
+		role.Permissions = *input.Permissions
+	}
+
+	if err := db.Save(&role).Error; err != nil {
+		if utils.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Já existe um papel com esse nome"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar papel"})
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+func DeleteSystemRole(c *gin.Context, db *gorm.DB) {
+	var role models.SystemRole
+	if err := db.First(&role, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Papel não encontrado"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_system_roles WHERE system_role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover papel"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Papel removido com sucesso"})
+}
+
+// SetUserSystemRoles substitui os papéis de sistema de um voluntário.
+// As novas permissões entram no token na próxima renovação da sessão.
+func SetUserSystemRoles(c *gin.Context, db *gorm.DB) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+
+	var input struct {
+		RoleIDs []uuid.UUID `json:"role_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	roles := []models.SystemRole{}
+	if len(input.RoleIDs) > 0 {
+		if err := db.Where("id IN ?", input.RoleIDs).Find(&roles).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar papéis"})
+			return
+		}
+		if len(roles) != len(input.RoleIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Papel não encontrado"})
+			return
+		}
+	}
+
+	if err := db.Model(&user).Association("SystemRoles").Replace(roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar papéis do usuário"})
+		return
+	}
+
+	user.SystemRoles = roles
+	c.JSON(http.StatusOK, gin.H{
+		"id":           user.ID,
+		"system_roles": roles,
+		"permissions":  user.Permissions(),
+	})
+}
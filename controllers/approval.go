@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+// approvedCheckins restringe uma consulta de check-ins aos voluntários aprovados,
+// para que cadastros pendentes ou recusados não apareçam em rankings e dashboards.
+func approvedCheckins(db *gorm.DB, query *gorm.DB) *gorm.DB {
+	return query.Where("volunteer_checkins.user_id IN (?)",
+		db.Model(&models.User{}).Select("id").Where("status = ?", models.UserStatusApproved))
+}
+
+// ListPendingVolunteers lista os cadastros aguardando aprovação, dos mais antigos aos mais novos.
+func ListPendingVolunteers(c *gin.Context, db *gorm.DB) {
+	var users []models.User
+	if err := db.Where("status = ?", models.UserStatusPending).Order("created_at ASC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar cadastros pendentes"})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func ApproveVolunteer(c *gin.Context, db *gorm.DB) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+
+	if err := db.Model(&user).Update("status", models.UserStatusApproved).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao aprovar cadastro"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cadastro aprovado com sucesso", "id": user.ID, "status": user.Status})
+}
+
+// RejectVolunteer recusa o cadastro e encerra as sessões abertas do voluntário.
+func RejectVolunteer(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+	if user.IsAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Não é possível recusar o cadastro de um admin"})
+		return
+	}
+
+	if err := db.Model(&user).Update("status", models.UserStatusRejected).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao recusar cadastro"})
+		return
+	}
+	if err := revokeUserSessions(db, cache, user.ID); err != nil {
+		log.Printf("Erro ao encerrar sessões do usuário %s: %v", user.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cadastro recusado", "id": user.ID, "status": user.Status})
+}
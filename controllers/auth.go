@@ -1,46 +1,23 @@
 package controllers
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
+	"errors"
+	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/nicolaslucianob/checkinfp/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/nicolaslucianob/checkinfp/utils"
 	"gorm.io/gorm"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-
-func GenerateToken(userID uint) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 3).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
-}
-
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
-}
-
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
-}
-
-func SignUp(c *gin.Context, db *gorm.DB) {
-	var input models.User
+func SignUp(c *gin.Context, db *gorm.DB, mailer utils.Mailer) {
+	var input volunteerInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
 		return
@@ -49,7 +26,16 @@ func SignUp(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "*Por favor, informe seu nome completo, varão(oa)"})
 		return
 	}
-	hashedPassword, err := HashPassword(input.Password)
+	roles, err := normalizeRoles(db, input.Roles, nil)
+	if err != nil {
+		respondRolesError(c, err)
+		return
+	}
+	if err := utils.ValidatePassword(input.Password, input.Name, input.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	hashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criptografar senha"})
 		return
@@ -58,133 +44,125 @@ func SignUp(c *gin.Context, db *gorm.DB) {
 		Name:     input.Name,
 		Email:    input.Email,
 		Password: hashedPassword,
-		Roles:    input.Roles,
+		Roles:    roles,
 		IsAdmin:  false,
+		Status:   models.UserStatusPending,
 	}
 	if err := db.Create(&user).Error; err != nil {
-		errMsg := err.Error()
-		if strings.Contains(errMsg, "duplicate key") ||
-			strings.Contains(errMsg, "UNIQUE constraint failed") ||
-			strings.Contains(errMsg, "duplicate entry") ||
-			strings.Contains(errMsg, "Error 1062") {
+		if utils.IsDuplicateKeyError(err) {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "*E-mail já cadastrado, irmão(ã)"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criar conta"})
 		}
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"message": "Voluntário criado com sucesso"})
+	// A conta já existe; se o e-mail falhar, o voluntário pode pedir o reenvio
+	if err := sendVerificationEmail(c, db, mailer, user); err != nil {
+		log.Printf("Erro ao enviar e-mail de confirmação para %s: %v", user.Email, err)
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Voluntário criado com sucesso! Confirme seu e-mail pelo link que enviamos e aguarde a aprovação de um admin"})
 }
 
-func Login(c *gin.Context, db *gorm.DB) {
+// Login confere as credenciais com proteção contra força bruta: tentativas erradas
+// são contadas por IP e por conta, atrasam a resposta progressivamente e, ao
+// atingir o limite, bloqueiam a conta temporariamente.
+func Login(c *gin.Context, db *gorm.DB, cache utils.Cache) {
 	var input models.LoginInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
 		return
 	}
+
+	limits := loadLoginLimits()
+	email := normalizeLoginEmail(input.Email)
+	if blocked, retryAfter := loginBlocked(cache, limits, email, c.ClientIP()); blocked {
+		respondLoginBlocked(c, retryAfter)
+		return
+	}
+
 	var user models.User
-	if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "*Email não encontrado, irmão(ã)"})
+	// Unscoped para reconhecer contas desativadas e responder com a mensagem certa
+	if err := db.Unscoped().Preload("SystemRoles").Where("email = ?", input.Email).First(&user).Error; err != nil {
+		compareDummyPassword(input.Password)
+		respondLoginFailure(c, cache, limits, email, loginFailedMessage)
 		return
 	}
-	if !CheckPasswordHash(input.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "*Senha errada, irmão(ã)"})
+	if !utils.CheckPasswordHash(input.Password, user.Password) {
+		respondLoginFailure(c, cache, limits, email, loginFailedMessage)
 		return
 	}
-	var expiration time.Time
-	if user.IsAdmin {
-		expiration = time.Now().AddDate(0, 1, 0) // 1 mês
-	} else {
-		expiration = time.Now().Add(time.Hour * 3) // 3 horas
+	_ = cache.Del(utils.Ctx, loginAccountKey(email))
+
+	// Se o custo do bcrypt mudou, aproveita a senha em claro para refazer o hash
+	if utils.PasswordNeedsRehash(user.Password) {
+		if hashed, err := utils.HashPassword(input.Password); err != nil {
+			log.Printf("Erro ao refazer hash da senha do usuário %s: %v", user.ID, err)
+		} else if err := db.Model(&user).Update("password", hashed).Error; err != nil {
+			log.Printf("Erro ao atualizar hash da senha do usuário %s: %v", user.ID, err)
+		}
 	}
 
-	claims := jwt.MapClaims{
-		"user_id":  user.ID,
-		"is_admin": user.IsAdmin,
-		"exp":      expiration.Unix(),
+	if user.DeletedAt.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Sua conta foi desativada. Procure a liderança do ministério"})
+		return
 	}
-	tokenObj := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token, err := tokenObj.SignedString(jwtKey)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token"})
+	if user.Status == models.UserStatusRejected {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Seu cadastro não foi aprovado. Procure a liderança do ministério"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":        user.ID,
-			"name":      user.Name,
-			"roles":     user.Roles,
-			"email":     user.Email,
-			"is_admin":  user.IsAdmin,
-			"photo_url": user.PhotoURL,
-		},
-	})
-}
-
-func generateResetToken(userID uuid.UUID) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID.String(),
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
+	if user.TOTPEnabledAt != nil {
+		respondTwoFactorChallenge(c, user)
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	startSession(c, db, user)
 }
 
-func sendResetEmail(email string, token string) error {
-	brevoAPIKey := os.Getenv("BREVO_API_KEY")
-	brevoSenderName := os.Getenv("BREVO_NAME")
-	brevoSenderEmail := os.Getenv("BREVO_SENDER_EMAIL")
-
-	if brevoAPIKey == "" {
-		return fmt.Errorf("BREVO_API_KEY não configurada")
-	}
+const resetTokenTTL = 15 * time.Minute
 
-	body := map[string]interface{}{
-		"sender": map[string]string{
-			"name":  brevoSenderName,
-			"email": brevoSenderEmail,
-		},
-		"to": []map[string]string{
-			{"email": email},
-		},
-		"subject": "Recuperação de Senha - CheckinFP",
-		"htmlContent": fmt.Sprintf(`
-			<p>Olá, irmão!(ã)</p>
-			<p>O atribulado esqueceu a senha e solicitou uma redefinição? Clique no botão abaixo:</p>
-			<p><a href="https://checkin-fp.vercel.app/reset-password?token=%s">Redefinir senha</a></p>
-			<p>Vigia, esse link expira em 15 minutos.</p>
-		`, token),
-	}
+var errResetTokenUsed = errors.New("token de redefinição já utilizado")
 
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return err
-	}
+// generateResetToken cria um token aleatório de redefinição de senha e invalida os
+// links enviados antes para o mesmo usuário. Não é um JWT, então não serve como
+// token de acesso à API.
+func generateResetToken(db *gorm.DB, userID uuid.UUID) (string, error) {
+	token := utils.GenerateRandomToken() + utils.GenerateRandomToken()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := invalidatePasswordResetTokens(tx, userID); err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    userID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(resetTokenTTL),
+		}).Error
+	})
+	return token, err
+}
 
-	req, err := http.NewRequest("POST", "https://api.brevo.com/v3/smtp/email", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("api-key", brevoAPIKey)
-	req.Header.Set("Content-Type", "application/json")
+// invalidatePasswordResetTokens marca como usados os links de redefinição ainda
+// pendentes do usuário (ex.: depois de uma troca de senha).
+func invalidatePasswordResetTokens(db *gorm.DB, userID uuid.UUID) error {
+	return db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
 
-	client := &http.Client{}
-	res, err := client.Do(req)
+// sendPasswordResetEmail gera um novo link de redefinição e o envia ao usuário.
+func sendPasswordResetEmail(ctx context.Context, db *gorm.DB, mailer utils.Mailer, user models.User) error {
+	token, err := generateResetToken(db, user.ID)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted && res.StatusCode != http.StatusCreated {
-		bodyBytes, _ := io.ReadAll(res.Body)
-		return fmt.Errorf("erro ao enviar e-mail: status %d, resposta: %s", res.StatusCode, string(bodyBytes))
-	}
-
-	return nil
+	return utils.SendTemplate(ctx, mailer, "password_reset", user.Email, gin.H{
+		"Link":             utils.FrontendURL("/reset-password", url.Values{"token": {token}}),
+		"ExpiresInMinutes": int(resetTokenTTL.Minutes()),
+	})
 }
 
-func ForgotPassword(c *gin.Context, db *gorm.DB) {
+// ForgotPassword responde da mesma forma exista ou não uma conta com o e-mail,
+// para não revelar quem é cadastrado. O envio acontece em segundo plano, para que
+// o tempo de resposta também não denuncie a conta.
+func ForgotPassword(c *gin.Context, db *gorm.DB, mailer utils.Mailer) {
 	var input struct {
 		Email string `json:"email"`
 	}
@@ -195,26 +173,22 @@ func ForgotPassword(c *gin.Context, db *gorm.DB) {
 	}
 
 	var user models.User
-	if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": "*Email não encontrado, irmão(ã)"})
-		return
-	}
-
-	token, err := generateResetToken(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token"})
-		return
-	}
-
-	if err := sendResetEmail(user.Email, token); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao enviar e-mail"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Enviaremos um link para redefinir sua senha, irmão(ã)."})
+	err := db.Where("LOWER(email) = ?", normalizeLoginEmail(input.Email)).First(&user).Error
+	if err == nil {
+		ctx := context.WithoutCancel(c.Request.Context())
+		go func() {
+			if err := sendPasswordResetEmail(ctx, db, mailer, user); err != nil {
+				log.Printf("Erro ao enviar e-mail de redefinição para %s: %v", user.Email, err)
+			}
+		}()
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Erro ao buscar usuário para redefinição de senha: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Se houver uma conta com este e-mail, enviaremos um link para redefinir sua senha, irmão(ã)."})
 }
 
-func ResetPassword(c *gin.Context, db *gorm.DB) {
+func ResetPassword(c *gin.Context, db *gorm.DB, cache utils.Cache) {
 	var input struct {
 		Token       string `json:"token"`
 		NewPassword string `json:"new_password"`
@@ -225,51 +199,56 @@ func ResetPassword(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	token, err := jwt.Parse(input.Token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("método de assinatura inválido")
-		}
-		return jwtKey, nil
-	})
-	if err != nil || !token.Valid {
+	var resetToken models.PasswordResetToken
+	if err := db.Where("token_hash = ? AND used_at IS NULL", utils.HashToken(input.Token)).First(&resetToken).Error; err != nil ||
+		time.Now().After(resetToken.ExpiresAt) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Token inválido ou expirado, irmão(ã)"})
 		return
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || claims["user_id"] == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Oremos...Token inválido"})
+	var user models.User
+	if err := db.First(&user, "id = ?", resetToken.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Voluntário não encontrado"})
 		return
 	}
 
-	userIDStr, ok := claims["user_id"].(string)
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "ID do voluntário inválido"})
+	if err := utils.ValidatePassword(input.NewPassword, user.Name, user.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
-	userID, err := uuid.Parse(userIDStr)
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Erro ao processar ID do voluntário"})
-		return
-	}
-
-	var user models.User
-	if err := db.First(&user, "id = ?", userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Voluntário não encontrado"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criptografar nova senha"})
 		return
 	}
 
-	hashedPassword, err := HashPassword(input.NewPassword)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// A condição em used_at garante que o token só seja aceito uma vez
+		result := tx.Model(&resetToken).Where("used_at IS NULL").Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errResetTokenUsed
+		}
+		if err := invalidatePasswordResetTokens(tx, user.ID); err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("password", hashedPassword).Error
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criptografar nova senha"})
+		if errors.Is(err, errResetTokenUsed) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Token inválido ou expirado, irmão(ã)"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar nova senha"})
 		return
 	}
 
-	user.Password = hashedPassword
-	if err := db.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar nova senha"})
-		return
+	// Quem tinha a senha antiga não continua logado
+	if err := revokeUserSessions(db, cache, user.ID); err != nil {
+		log.Printf("Erro ao encerrar sessões do usuário %s: %v", user.ID, err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Senha redefinida com sucesso, irmão(ã)"})
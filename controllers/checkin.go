@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,23 +14,73 @@ import (
 	"gorm.io/gorm"
 )
 
-func CheckIn(c *gin.Context, db *gorm.DB) {
+func CheckIn(c *gin.Context, db *gorm.DB, cache utils.Cache) {
 	token := c.Query("token")
 	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Token ausente na requisição"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token ausente na requisição", "code": "token_missing"})
 		return
 	}
 
-	client := utils.NewRedisClient()
-	defer client.Close()
+	now := time.Now()
 
-	redisKey := fmt.Sprintf("checkinfp:token:%s", token)
-	val, err := client.Get(utils.Ctx, redisKey).Result()
-	if err != nil || val != "valid" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "QR Code inválido ou expirado"})
+	var record qrTokenRecord
+	if isRotatingToken(token) {
+		rotating, ok := verifyRotatingToken(cache, token, now)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "QR Code inválido ou expirado", "code": "token_invalid"})
+			return
+		}
+		record = *rotating
+	} else {
+		redisKey := fmt.Sprintf("checkinfp:token:%s", token)
+		val, err := cache.Get(utils.Ctx, redisKey)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "QR Code inválido ou expirado", "code": "token_invalid"})
+			return
+		}
+		if err := json.Unmarshal([]byte(val), &record); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "QR Code inválido ou expirado", "code": "token_invalid"})
+			return
+		}
+	}
+
+	if now.Before(record.ValidFrom) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Este QR Code ainda não está liberado para check-in", "code": "token_not_yet_valid"})
+		return
+	}
+	if now.After(record.ValidUntil) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "QR Code expirado", "code": "token_expired"})
 		return
 	}
 
+	// O evento esperado é sempre o culto atual, decidido pelo servidor.
+	var event *models.Event
+	if record.EventID != "" {
+		current, err := findCurrentEvent(db, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar evento atual"})
+			return
+		}
+		if current != nil && current.ID.String() != record.EventID {
+			c.JSON(http.StatusConflict, gin.H{"error": "Este QR Code pertence a outro culto", "code": "token_wrong_event"})
+			return
+		}
+
+		var found models.Event
+		if err := db.First(&found, "id = ?", record.EventID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Evento do QR Code não encontrado", "code": "event_not_found"})
+			return
+		}
+		event = &found
+	} else {
+		current, err := ensureCurrentEvent(db, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar evento atual"})
+			return
+		}
+		event = current
+	}
+
 	userIDVal, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuário não autenticado"})
@@ -37,27 +88,38 @@ func CheckIn(c *gin.Context, db *gorm.DB) {
 	}
 	userID := userIDVal.(uuid.UUID)
 
-	// Impede múltiplos check-ins por usuário no mesmo período
-	checkUserKey := fmt.Sprintf("checkinfp:user_checkin:%d", userID)
-	alreadyChecked, _ := client.Exists(utils.Ctx, checkUserKey).Result()
-	if alreadyChecked > 0 {
-		c.JSON(http.StatusConflict, gin.H{"message": "Você já fez o check-in para este culto! 🙌🏽"})
-		return
-	}
-
 	var user models.User
 	if err := db.First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Usuário não encontrado"})
 		return
 	}
-
-	checkKey := fmt.Sprintf("checkinfp:checkin:%d:%s", userID, token)
-	success, err := client.SetNX(utils.Ctx, checkKey, "done", 3*time.Hour).Result()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao acessar o cache"})
+	if user.Status != models.UserStatusApproved {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Seu cadastro ainda aguarda a aprovação de um admin", "code": "account_pending"})
 		return
 	}
-	if !success {
+	if user.EmailVerifiedAt == nil {
+		allowed, err := models.GetBoolSetting(db, models.SettingAllowUnverifiedCheckin)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar configurações"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Confirme seu e-mail antes de fazer check-in", "code": "email_not_verified"})
+			return
+		}
+	}
+
+	// Impede múltiplos check-ins do usuário no mesmo evento (o cache é só um
+	// atalho: a garantia fica no índice único do banco). Sem evento, vale o token.
+	dedupScope := token
+	if event != nil {
+		dedupScope = event.ID.String()
+	}
+	checkKey := checkinDedupKey(userID, dedupScope)
+	success, err := cache.SetNX(utils.Ctx, checkKey, "done", 3*time.Hour)
+	if err != nil {
+		log.Printf("Erro ao acessar o cache no check-in: %v", err)
+	} else if !success {
 		c.JSON(http.StatusConflict, gin.H{
 			"message": "Você já fez o check-in para este culto! 🙌🏽",
 		})
@@ -66,22 +128,45 @@ func CheckIn(c *gin.Context, db *gorm.DB) {
 
 	checkin := models.VolunteerCheckin{
 		UserID:      user.ID,
-		CheckinTime: time.Now(),
+		CheckinTime: now,
+	}
+	if event != nil {
+		checkin.EventID = &event.ID
 	}
 	if err := db.Create(&checkin).Error; err != nil {
-		_ = client.Del(utils.Ctx, checkKey).Err()
+		if utils.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"message": "Você já fez o check-in para este culto! 🙌🏽",
+			})
+			return
+		}
+		_ = cache.Del(utils.Ctx, checkKey)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao registrar check-in"})
 		return
 	}
 
-	_ = client.Set(utils.Ctx, checkUserKey, "done", 3*time.Hour).Err()
-
 	log.Printf("Check-in realizado com sucesso: %s", user.Name)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "✅ Check-in realizado com sucesso\nHora de servir com alegria!",
 	})
 }
 
+// checkinDedupKey é a chave do cache que marca o check-in do usuário no evento.
+func checkinDedupKey(userID uuid.UUID, scope string) string {
+	return fmt.Sprintf("checkinfp:checkin:%s:%s", userID, scope)
+}
+
+// clearCheckinDedup libera o usuário para fazer check-in de novo no evento (ex.:
+// depois que um admin remove um check-in registrado por engano).
+func clearCheckinDedup(cache utils.Cache, userID uuid.UUID, eventID *uuid.UUID) {
+	if eventID == nil {
+		return
+	}
+	if err := cache.Del(utils.Ctx, checkinDedupKey(userID, eventID.String())); err != nil {
+		log.Printf("Erro ao limpar check-in do usuário %s no cache: %v", userID, err)
+	}
+}
+
 func ListCheckins(c *gin.Context, db *gorm.DB) {
 	var checkins []models.VolunteerCheckin
 	if err := db.Find(&checkins).Error; err != nil {
@@ -130,6 +215,7 @@ func CheckinRanking(c *gin.Context, db *gorm.DB) {
 	err := db.Table("volunteer_checkins").
 		Select("users.id, users.name, COUNT(volunteer_checkins.id) as total_checkins").
 		Joins("JOIN users ON users.id = volunteer_checkins.user_id").
+		Where("users.status = ? AND users.deleted_at IS NULL", models.UserStatusApproved).
 		Group("users.id, users.name").
 		Order("total_checkins DESC").
 		Scan(&results).Error
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/middlewares"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+type manualCheckinInput struct {
+	UserID      *uuid.UUID `json:"user_id"`
+	EventID     *uuid.UUID `json:"event_id"`
+	CheckinTime *time.Time `json:"checkin_time"`
+	Reason      string     `json:"reason"`
+}
+
+// canManageCheckinsOf indica se o usuário autenticado pode registrar e corrigir
+// check-ins do voluntário: com checkins:manage, de qualquer um; com checkins:team,
+// só de quem faz parte de uma das suas equipes. Responde 403 quando não pode.
+func canManageCheckinsOf(c *gin.Context, db *gorm.DB, volunteerID uuid.UUID) bool {
+	if middlewares.HasPermission(c, models.PermissionCheckinsManage) {
+		return true
+	}
+	if middlewares.HasPermission(c, models.PermissionCheckinsTeam) {
+		var actor, volunteer models.User
+		actorID, _ := c.Get("user_id")
+		if db.First(&actor, "id = ?", actorID).Error == nil &&
+			db.Unscoped().First(&volunteer, "id = ?", volunteerID).Error == nil &&
+			shareTeam(actor.Roles, volunteer.Roles) {
+			return true
+		}
+	}
+	c.JSON(http.StatusForbidden, gin.H{"message": "Você só pode alterar check-ins de voluntários da sua equipe"})
+	return false
+}
+
+func shareTeam(a, b models.RolesArray) bool {
+	for _, role := range a {
+		for _, other := range b {
+			if role == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CreateManualCheckin registra o check-in de um voluntário em nome dele
+// (ex.: celular descarregado). O evento pode ser informado ou deduzido pelo horário.
+func CreateManualCheckin(c *gin.Context, db *gorm.DB) {
+	actorIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return
+	}
+	actorID := actorIDVal.(uuid.UUID)
+
+	var input manualCheckinInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.UserID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Informe o motivo do check-in manual"})
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", *input.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Voluntário não encontrado"})
+		return
+	}
+	if !canManageCheckinsOf(c, db, user.ID) {
+		return
+	}
+
+	checkinTime := time.Now()
+	if input.CheckinTime != nil {
+		checkinTime = *input.CheckinTime
+	}
+
+	var event *models.Event
+	if input.EventID != nil {
+		var found models.Event
+		if err := db.First(&found, "id = ?", *input.EventID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Evento não encontrado"})
+			return
+		}
+		event = &found
+	} else {
+		found, err := findCurrentEvent(db, checkinTime)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar evento"})
+			return
+		}
+		if found == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Nenhum evento encontrado para o horário informado"})
+			return
+		}
+		event = found
+	}
+
+	checkin := models.VolunteerCheckin{
+		UserID:      user.ID,
+		EventID:     &event.ID,
+		CheckinTime: checkinTime,
+		Source:      "manual",
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&checkin).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.CheckinAudit{
+			CheckinID: checkin.ID,
+			UserID:    user.ID,
+			ActorID:   actorID,
+			Action:    "create",
+			Reason:    reason,
+			NewTime:   &checkinTime,
+			EventID:   &event.ID,
+		}).Error
+	})
+	if err != nil {
+		if utils.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Voluntário já possui check-in neste evento"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao registrar check-in"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, checkin)
+}
+
+// UpdateCheckin corrige o horário (e, opcionalmente, o evento) de um check-in existente.
+func UpdateCheckin(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	actorIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return
+	}
+	actorID := actorIDVal.(uuid.UUID)
+
+	var checkin models.VolunteerCheckin
+	if err := db.First(&checkin, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Check-in não encontrado"})
+		return
+	}
+	if !canManageCheckinsOf(c, db, checkin.UserID) {
+		return
+	}
+
+	var input manualCheckinInput
+	if err := c.ShouldBindJSON(&input); err != nil || (input.CheckinTime == nil && input.EventID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Informe o motivo da correção"})
+		return
+	}
+
+	previousTime := checkin.CheckinTime
+	previousEventID := checkin.EventID
+	if input.CheckinTime != nil {
+		checkin.CheckinTime = *input.CheckinTime
+	}
+	if input.EventID != nil {
+		var event models.Event
+		if err := db.First(&event, "id = ?", *input.EventID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Evento não encontrado"})
+			return
+		}
+		checkin.EventID = &event.ID
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&checkin).Updates(map[string]interface{}{
+			"checkin_time": checkin.CheckinTime,
+			"event_id":     checkin.EventID,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.CheckinAudit{
+			CheckinID:    checkin.ID,
+			UserID:       checkin.UserID,
+			ActorID:      actorID,
+			Action:       "update",
+			Reason:       reason,
+			PreviousTime: &previousTime,
+			NewTime:      &checkin.CheckinTime,
+			EventID:      checkin.EventID,
+		}).Error
+	})
+	if err != nil {
+		if utils.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Voluntário já possui check-in neste evento"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao corrigir check-in"})
+		return
+	}
+	// Se o check-in mudou de evento, o voluntário pode fazer check-in no evento antigo
+	if previousEventID != nil && (checkin.EventID == nil || *previousEventID != *checkin.EventID) {
+		clearCheckinDedup(cache, checkin.UserID, previousEventID)
+	}
+
+	c.JSON(http.StatusOK, checkin)
+}
+
+// DeleteCheckin remove um check-in registrado por engano. O motivo vem no corpo
+// ({"reason": "..."}) ou na query (?reason=).
+func DeleteCheckin(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	actorIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return
+	}
+	actorID := actorIDVal.(uuid.UUID)
+
+	var input manualCheckinInput
+	_ = c.ShouldBindJSON(&input)
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		reason = strings.TrimSpace(c.Query("reason"))
+	}
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Informe o motivo da remoção"})
+		return
+	}
+
+	var checkin models.VolunteerCheckin
+	if err := db.First(&checkin, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Check-in não encontrado"})
+		return
+	}
+	if !canManageCheckinsOf(c, db, checkin.UserID) {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&checkin).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.CheckinAudit{
+			CheckinID:    checkin.ID,
+			UserID:       checkin.UserID,
+			ActorID:      actorID,
+			Action:       "delete",
+			Reason:       reason,
+			PreviousTime: &checkin.CheckinTime,
+			EventID:      checkin.EventID,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover check-in"})
+		return
+	}
+	clearCheckinDedup(cache, checkin.UserID, checkin.EventID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Check-in removido com sucesso"})
+}
+
+// GetCheckinAudit lista o histórico de alterações manuais de um check-in.
+func GetCheckinAudit(c *gin.Context, db *gorm.DB) {
+	var audits []models.CheckinAudit
+	if err := db.Where("checkin_id = ?", c.Param("id")).Order("created_at ASC").Find(&audits).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar histórico do check-in"})
+		return
+	}
+	if len(audits) > 0 && !canManageCheckinsOf(c, db, audits[0].UserID) {
+		return
+	}
+	c.JSON(http.StatusOK, audits)
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
+)
+
+func TestCanManageCheckinsOf(t *testing.T) {
+	db := testDB(t)
+	leader := createTestUser(t, db)
+	sameTeam := createTestUser(t, db)
+	otherTeam := createTestUser(t, db)
+	for user, roles := range map[*models.User]models.RolesArray{
+		&leader:    {"camera", "projecao"},
+		&sameTeam:  {"camera"},
+		&otherTeam: {"som"},
+	} {
+		if err := db.Model(user).Update("roles", roles).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		permissions []string
+		volunteer   models.User
+		allowed     bool
+	}{
+		{"checkins:manage em outra equipe", []string{models.PermissionCheckinsManage}, otherTeam, true},
+		{"checkins:team na mesma equipe", []string{models.PermissionCheckinsTeam}, sameTeam, true},
+		{"checkins:team em outra equipe", []string{models.PermissionCheckinsTeam}, otherTeam, false},
+		{"sem permissão", nil, sameTeam, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("user_id", leader.ID)
+			c.Set("is_admin", false)
+			c.Set("permissions", tt.permissions)
+
+			if got := canManageCheckinsOf(c, db, tt.volunteer.ID); got != tt.allowed {
+				t.Errorf("canManageCheckinsOf = %v, esperado %v", got, tt.allowed)
+			}
+			if !tt.allowed && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, esperado 403", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+// storeStaticToken salva no cache um QR estático com a janela informada.
+func storeStaticToken(t *testing.T, cache utils.Cache, record qrTokenRecord) string {
+	t.Helper()
+	token := utils.GenerateRandomToken()
+	value, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set(utils.Ctx, "checkinfp:token:"+token, string(value), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// checkIn chama o CheckIn com o token e devolve o status e o code da resposta.
+func checkIn(db *gorm.DB, cache utils.Cache, userID uuid.UUID, token string) (int, string) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/checkin?token="+token, nil)
+	c.Set("user_id", userID)
+
+	CheckIn(c, db, cache)
+	var body struct {
+		Code string `json:"code"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body.Code
+}
+
+// Erros decididos só pelo token, antes de qualquer consulta ao banco.
+func TestCheckInTokenErrors(t *testing.T) {
+	cache := utils.NewMemoryCache()
+	now := time.Now()
+	eventID := uuid.NewString()
+	notYet := storeStaticToken(t, cache, qrTokenRecord{EventID: eventID, ValidFrom: now.Add(time.Hour), ValidUntil: now.Add(2 * time.Hour)})
+	expired := storeStaticToken(t, cache, qrTokenRecord{EventID: eventID, ValidFrom: now.Add(-2 * time.Hour), ValidUntil: now.Add(-time.Hour)})
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		code   string
+	}{
+		{"sem token", "", http.StatusBadRequest, "token_missing"},
+		{"token desconhecido", "nao-existe", http.StatusUnauthorized, "token_invalid"},
+		{"rotativo sem sessão", rotatingTokenPrefix + eventID + ".0123456789abcdef", http.StatusUnauthorized, "token_invalid"},
+		{"antes da janela", notYet, http.StatusForbidden, "token_not_yet_valid"},
+		{"depois da janela", expired, http.StatusUnauthorized, "token_expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := checkIn(nil, cache, uuid.New(), tt.token)
+			if status != tt.status || code != tt.code {
+				t.Errorf("CheckIn = %d %q, esperado %d %q", status, code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestCheckInAccountAndEventErrors(t *testing.T) {
+	db := testDB(t)
+	cache := utils.NewMemoryCache()
+	now := time.Now()
+
+	today := models.Event{Title: "Culto de teste", Date: eventDate(now), StartTime: now.Add(-30 * time.Minute)}
+	yesterday := models.Event{Title: "Culto de ontem", Date: eventDate(now.AddDate(0, 0, -1)), StartTime: now.AddDate(0, 0, -1)}
+	for _, event := range []*models.Event{&today, &yesterday} {
+		if err := db.Create(event).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Where("event_id IN ?", []uuid.UUID{today.ID, yesterday.ID}).Delete(&models.VolunteerCheckin{})
+		db.Delete(&models.Event{}, "id IN ?", []uuid.UUID{today.ID, yesterday.ID})
+	})
+	current, err := findCurrentEvent(db, now)
+	if err != nil || current == nil {
+		t.Fatalf("evento atual não encontrado: %v", err)
+	}
+
+	window := qrTokenRecord{ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)}
+	currentRecord, otherRecord := window, window
+	currentRecord.EventID = current.ID.String()
+	otherRecord.EventID = yesterday.ID.String()
+	if current.ID == yesterday.ID {
+		t.Fatal("o evento de ontem não pode ser o atual")
+	}
+	currentToken := storeStaticToken(t, cache, currentRecord)
+	otherToken := storeStaticToken(t, cache, otherRecord)
+
+	verified := createTestUser(t, db)
+	db.Model(&verified).Update("email_verified_at", now)
+	pending := createTestUser(t, db)
+	db.Model(&pending).Update("status", models.UserStatusPending)
+	unverified := createTestUser(t, db)
+
+	tests := []struct {
+		name   string
+		user   models.User
+		token  string
+		cache  utils.Cache
+		status int
+		code   string
+	}{
+		{"QR de outro culto", verified, otherToken, cache, http.StatusConflict, "token_wrong_event"},
+		{"cadastro pendente", pending, currentToken, cache, http.StatusForbidden, "account_pending"},
+		{"e-mail não confirmado", unverified, currentToken, cache, http.StatusForbidden, "email_not_verified"},
+		{"check-in válido", verified, currentToken, cache, http.StatusOK, ""},
+		{"check-in repetido", verified, currentToken, cache, http.StatusConflict, ""},
+		// Sem a marca no cache (outra instância), o índice único do banco barra o repetido
+		{"check-in repetido sem cache", verified, currentToken, utils.NewMemoryCache(), http.StatusConflict, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := checkIn(db, tt.cache, tt.user.ID, tt.token)
+			if status != tt.status || code != tt.code {
+				t.Errorf("CheckIn = %d %q, esperado %d %q", status, code, tt.status, tt.code)
+			}
+		})
+	}
+}
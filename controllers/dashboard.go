@@ -1,13 +1,16 @@
 package controllers
 
 import (
+	"encoding/json"
 	"net/http"
 	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/middlewares"
 	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
 	"gorm.io/gorm"
 )
 
@@ -35,7 +38,7 @@ func GetVolunteerDashboardData(c *gin.Context, db *gorm.DB) {
 	var checkinsThisMonth int
 
 	if len(checkins) > 0 {
-		location, _ := time.LoadLocation("America/Sao_Paulo")
+		location := utils.SaoPaulo
 		first := checkins[len(checkins)-1].CheckinTime.In(location)
 		last := checkins[0].CheckinTime.In(location)
 		firstCheckin = &first
@@ -60,6 +63,7 @@ func GetVolunteerDashboardData(c *gin.Context, db *gorm.DB) {
 	if err := db.Table("volunteer_checkins").
 		Select("users.id, users.name, COUNT(volunteer_checkins.id) as total_checkins").
 		Joins("JOIN users ON users.id = volunteer_checkins.user_id").
+		Where("users.status = ? AND users.deleted_at IS NULL", models.UserStatusApproved).
 		Group("users.id, users.name").
 		Order("total_checkins DESC").
 		Scan(&ranking).Error; err != nil {
@@ -91,12 +95,14 @@ func GetVolunteerDashboardData(c *gin.Context, db *gorm.DB) {
 func GetRolesDistribution(c *gin.Context, db *gorm.DB) {
 	type RolePercentage struct {
 		Role       string  `json:"role"`
+		Slug       string  `json:"slug"`
+		Color      string  `json:"color"`
 		Percentage float64 `json:"percentage"`
 		Count      int     `json:"count"`
 	}
 
 	var users []models.User
-	if err := db.Find(&users).Error; err != nil {
+	if err := db.Where("status = ?", models.UserStatusApproved).Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuários"})
 		return
 	}
@@ -107,6 +113,16 @@ func GetRolesDistribution(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	var catalog []models.Role
+	if err := db.Find(&catalog).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar funções"})
+		return
+	}
+	rolesBySlug := make(map[string]models.Role, len(catalog))
+	for _, role := range catalog {
+		rolesBySlug[role.Slug] = role
+	}
+
 	roleMap := make(map[string]int)
 	for _, user := range users {
 		seen := make(map[string]bool)
@@ -119,13 +135,19 @@ func GetRolesDistribution(c *gin.Context, db *gorm.DB) {
 	}
 
 	var distribution []RolePercentage
-	for role, count := range roleMap {
+	for slug, count := range roleMap {
 		percentage := (float64(count) / float64(totalUsers)) * 100
-		distribution = append(distribution, RolePercentage{
-			Role:       role,
+		entry := RolePercentage{
+			Role:       slug,
+			Slug:       slug,
 			Percentage: percentage,
 			Count:      count,
-		})
+		}
+		if role, ok := rolesBySlug[slug]; ok {
+			entry.Role = role.Name
+			entry.Color = role.Color
+		}
+		distribution = append(distribution, entry)
 	}
 
 	c.JSON(http.StatusOK, distribution)
@@ -147,6 +169,13 @@ func calculatePunctualitySummaries(checkins []models.VolunteerCheckin, idealTime
 		entry := summaryMap[userID]
 		entry.Total++
 
+		if checkin.Event != nil {
+			if checkin.Event.StartTime.Sub(checkin.CheckinTime) >= 45*time.Minute {
+				entry.Punctual++
+			}
+			continue
+		}
+
 		ideals, ok := idealTimes[checkin.CheckinTime.Weekday()]
 		if ok {
 			for _, ideal := range ideals {
@@ -166,16 +195,74 @@ func calculatePunctualitySummaries(checkins []models.VolunteerCheckin, idealTime
 	return summaryMap
 }
 
-func getIdealTimes() map[time.Weekday][]time.Time {
-	return map[time.Weekday][]time.Time{
-		time.Sunday:    {time.Date(0, 1, 1, 9, 0, 0, 0, time.UTC), time.Date(0, 1, 1, 17, 0, 0, 0, time.UTC)},
-		time.Monday:    {time.Date(0, 1, 1, 19, 0, 0, 0, time.UTC)},
-		time.Tuesday:   {time.Date(0, 1, 1, 19, 0, 0, 0, time.UTC)},
-		time.Wednesday: {time.Date(0, 1, 1, 19, 0, 0, 0, time.UTC)},
-		time.Thursday:  {time.Date(0, 1, 1, 19, 0, 0, 0, time.UTC)},
-		time.Friday:    {time.Date(0, 1, 1, 19, 0, 0, 0, time.UTC)},
-		time.Saturday:  {time.Date(0, 1, 1, 18, 0, 0, 0, time.UTC)},
+// filterByPeriod restringe a consulta de check-ins ao período pedido no dashboard.
+// "last_event" usa o último evento com check-ins registrados.
+func filterByPeriod(db *gorm.DB, query *gorm.DB, period string) *gorm.DB {
+	now := time.Now()
+	switch period {
+	case "last_event":
+		var lastCheckin models.VolunteerCheckin
+		if err := db.Where("event_id IS NOT NULL").Order("checkin_time DESC").First(&lastCheckin).Error; err == nil {
+			return query.Where("event_id = ?", *lastCheckin.EventID)
+		}
+		return query.Where("checkin_time >= ?", now.AddDate(0, 0, -7))
+	case "total":
+		return query
+	default: // "monthly"
+		return query.Where("checkin_time >= ?", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()))
+	}
+}
+
+// filterByTeam aplica o filtro ?team= dos dashboards. Admins podem ver qualquer
+// equipe; quem tem dashboard:team só vê as equipes das quais faz parte.
+// Retorna false (e já responde 403) quando o acesso não é permitido.
+func filterByTeam(c *gin.Context, db *gorm.DB, query *gorm.DB) (*gorm.DB, bool) {
+	team := utils.Slugify(c.Query("team"))
+	if team == "" {
+		return query, true
+	}
+
+	if isAdmin, _ := c.Get("is_admin"); isAdmin != true {
+		allowed := false
+		if middlewares.HasPermission(c, models.PermissionDashboardTeam) {
+			var user models.User
+			if userID, exists := c.Get("user_id"); exists && db.First(&user, "id = ?", userID).Error == nil {
+				for _, role := range user.Roles {
+					if role == team {
+						allowed = true
+						break
+					}
+				}
+			}
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Você não tem permissão para ver o dashboard desta equipe"})
+			return nil, false
+		}
+	}
+
+	filter, _ := json.Marshal([]string{team})
+	return query.Where("user_id IN (?)", db.Model(&models.User{}).Select("id").Where("roles::jsonb @> ?", string(filter))), true
+}
+
+// loadIdealTimes monta, a partir dos horários de culto cadastrados, o mapa
+// dia da semana → horários de início usado no cálculo de pontualidade.
+func loadIdealTimes(db *gorm.DB) (map[time.Weekday][]time.Time, error) {
+	var schedules []models.ServiceSchedule
+	if err := db.Where("cancelled = ?", false).Order("start_time ASC").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	idealTimes := make(map[time.Weekday][]time.Time)
+	for _, schedule := range schedules {
+		start, err := time.Parse("15:04", schedule.StartTime)
+		if err != nil {
+			continue
+		}
+		idealTimes[schedule.Weekday] = append(idealTimes[schedule.Weekday],
+			time.Date(0, 1, 1, start.Hour(), start.Minute(), 0, 0, time.UTC))
 	}
+	return idealTimes, nil
 }
 
 func GetPunctualityRanking(c *gin.Context, db *gorm.DB) {
@@ -192,28 +279,17 @@ func GetPunctualityRanking(c *gin.Context, db *gorm.DB) {
 		Percentage float64   `json:"percentage"`
 	}
 
-	now := time.Now()
-	var startDate time.Time
-	switch period {
-	case "monthly":
-		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	case "last_event":
-		var lastCheckin models.VolunteerCheckin
-		if err := db.Order("checkin_time DESC").First(&lastCheckin).Error; err == nil {
-			startDate = lastCheckin.CheckinTime.Truncate(24 * time.Hour)
-		} else {
-			startDate = now.AddDate(0, 0, -7)
-		}
-	case "total":
-		startDate = time.Time{}
-	default:
-		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	idealTimes, err := loadIdealTimes(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar horários de culto"})
+		return
 	}
 
-	idealTimes := getIdealTimes()
-
 	var checkins []models.VolunteerCheckin
-	query := db.Preload("User").Where("checkin_time >= ?", startDate)
+	query, ok := filterByTeam(c, db, approvedCheckins(db, filterByPeriod(db, db.Preload("User").Preload("Event"), period)))
+	if !ok {
+		return
+	}
 	if scope == "individual" {
 		userIDVal, exists := c.Get("user_id")
 		if !exists {
@@ -234,7 +310,7 @@ func GetPunctualityRanking(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	location, _ := time.LoadLocation("America/Sao_Paulo")
+	location := utils.SaoPaulo
 	punctualityMap := make(map[uuid.UUID]*PunctualityEntry)
 
 	for _, checkin := range checkins {
@@ -252,6 +328,13 @@ func GetPunctualityRanking(c *gin.Context, db *gorm.DB) {
 		entry := punctualityMap[userID]
 		entry.Checkins++
 
+		if checkin.Event != nil {
+			if checkin.Event.StartTime.Sub(checkinTime) >= 45*time.Minute {
+				entry.Punctual++
+			}
+			continue
+		}
+
 		ideals, ok := idealTimes[checkinTime.Weekday()]
 		if ok {
 			for _, ideal := range ideals {
@@ -301,28 +384,19 @@ func GetPunctualityRanking(c *gin.Context, db *gorm.DB) {
 func GetPunctualityMeter(c *gin.Context, db *gorm.DB) {
 	period := c.DefaultQuery("period", "monthly")
 
-	now := time.Now()
-	var startDate time.Time
-	switch period {
-	case "monthly":
-		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	case "last_event":
-		var lastCheckin models.VolunteerCheckin
-		if err := db.Order("checkin_time DESC").First(&lastCheckin).Error; err == nil {
-			startDate = lastCheckin.CheckinTime.Truncate(24 * time.Hour)
-		} else {
-			startDate = now.AddDate(0, 0, -7)
-		}
-	case "total":
-		startDate = time.Time{}
-	default:
-		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	idealTimes, err := loadIdealTimes(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar horários de culto"})
+		return
 	}
 
-	idealTimes := getIdealTimes()
+	query, ok := filterByTeam(c, db, approvedCheckins(db, filterByPeriod(db, db.Preload("User").Preload("Event"), period)))
+	if !ok {
+		return
+	}
 
 	var checkins []models.VolunteerCheckin
-	if err := db.Preload("User").Where("checkin_time >= ?", startDate).Find(&checkins).Error; err != nil {
+	if err := query.Find(&checkins).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar check-ins"})
 		return
 	}
@@ -332,7 +406,7 @@ func GetPunctualityMeter(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	location, _ := time.LoadLocation("America/Sao_Paulo")
+	location := utils.SaoPaulo
 	for i := range checkins {
 		checkins[i].CheckinTime = checkins[i].CheckinTime.In(location)
 	}
@@ -360,26 +434,11 @@ func GetCheckinScatterData(c *gin.Context, db *gorm.DB) {
 	period := c.DefaultQuery("period", "monthly")
 	scope := c.DefaultQuery("scope", "team")
 
-	now := time.Now()
-	var startDate time.Time
-	switch period {
-	case "monthly":
-		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	case "last_event":
-		var lastCheckin models.VolunteerCheckin
-		if err := db.Order("checkin_time DESC").First(&lastCheckin).Error; err == nil {
-			startDate = lastCheckin.CheckinTime.Truncate(24 * time.Hour)
-		} else {
-			startDate = now.AddDate(0, 0, -7)
-		}
-	case "total":
-		startDate = time.Time{}
-	default:
-		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	}
-
 	var checkins []models.VolunteerCheckin
-	query := db.Preload("User").Where("checkin_time >= ?", startDate)
+	query, ok := filterByTeam(c, db, approvedCheckins(db, filterByPeriod(db, db.Preload("User"), period)))
+	if !ok {
+		return
+	}
 
 	if scope == "individual" {
 		userIDVal, exists := c.Get("user_id")
@@ -406,7 +465,7 @@ func GetCheckinScatterData(c *gin.Context, db *gorm.DB) {
 		Date        string `json:"date"`
 	}
 
-	location, _ := time.LoadLocation("America/Sao_Paulo")
+	location := utils.SaoPaulo
 	var data []ScatterPoint
 	for _, ci := range checkins {
 		t := ci.CheckinTime.In(location)
@@ -428,12 +487,12 @@ func GetCheckinScatterData(c *gin.Context, db *gorm.DB) {
 
 func GetCheckinHistory(c *gin.Context, db *gorm.DB) {
 	var checkins []models.VolunteerCheckin
-	if err := db.Preload("User").Order("checkin_time DESC").Find(&checkins).Error; err != nil {
+	if err := approvedCheckins(db, db.Preload("User")).Order("checkin_time DESC").Find(&checkins).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar histórico de check-ins"})
 		return
 	}
 
-	location, _ := time.LoadLocation("America/Sao_Paulo")
+	location := utils.SaoPaulo
 
 	type CheckinRecord struct {
 		ID   string `json:"id"`
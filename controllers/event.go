@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+type eventInput struct {
+	Title         *string    `json:"title"`
+	StartTime     *time.Time `json:"start_time"`
+	Location      *string    `json:"location"`
+	ExpectedTeams *[]string  `json:"expected_teams"`
+}
+
+func eventDate(start time.Time) time.Time {
+	location := utils.SaoPaulo
+	local := start.In(location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+}
+
+// createEventsFromSchedules gera os eventos do dia a partir dos horários de culto
+// ativos, ignorando os que já foram gerados.
+func createEventsFromSchedules(db *gorm.DB, day time.Time) error {
+	location := utils.SaoPaulo
+	day = day.In(location)
+
+	var schedules []models.ServiceSchedule
+	if err := db.Where("weekday = ? AND cancelled = ?", day.Weekday(), false).Find(&schedules).Error; err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		start, err := time.Parse("15:04", schedule.StartTime)
+		if err != nil {
+			continue
+		}
+		startTime := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, location)
+
+		var count int64
+		if err := db.Model(&models.Event{}).
+			Where("schedule_id = ? AND start_time = ?", schedule.ID, startTime).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		scheduleID := schedule.ID
+		title := schedule.Title
+		if title == "" {
+			title = "Culto"
+		}
+		event := models.Event{
+			Title:      title,
+			Date:       eventDate(startTime),
+			StartTime:  startTime,
+			ScheduleID: &scheduleID,
+		}
+		// Outra requisição pode ter gerado o mesmo evento ao mesmo tempo
+		if err := db.Create(&event).Error; err != nil && !utils.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// findCurrentEvent retorna o evento do dia que está para começar ou em andamento.
+// Depois do último culto do dia, retorna o último evento. Retorna nil se não houver evento no dia.
+func findCurrentEvent(db *gorm.DB, now time.Time) (*models.Event, error) {
+	var events []models.Event
+	if err := db.Where("date = ?", eventDate(now)).Order("start_time ASC").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	for i := range events {
+		if events[i].StartTime.Add(2 * time.Hour).After(now) {
+			return &events[i], nil
+		}
+	}
+	return &events[len(events)-1], nil
+}
+
+// ensureCurrentEvent é como findCurrentEvent, mas gera antes os eventos do dia
+// a partir dos horários de culto cadastrados. Em dias sem culto cadastrado, cria
+// um evento extra começando agora, para que todo check-in fique vinculado a um evento.
+func ensureCurrentEvent(db *gorm.DB, now time.Time) (*models.Event, error) {
+	if err := createEventsFromSchedules(db, now); err != nil {
+		return nil, err
+	}
+	event, err := findCurrentEvent(db, now)
+	if err != nil || event != nil {
+		return event, err
+	}
+
+	// Check-ins simultâneos criariam um evento extra cada e dividiriam os check-ins
+	// entre eles; o lock do dia serializa a criação e a busca é refeita depois dele.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", extraEventLockKey(now)).Error; err != nil {
+			return err
+		}
+		found, err := findCurrentEvent(tx, now)
+		if err != nil || found != nil {
+			event = found
+			return err
+		}
+
+		extra := models.Event{
+			Title:     "Evento extra",
+			Date:      eventDate(now),
+			StartTime: now,
+		}
+		if err := tx.Create(&extra).Error; err != nil {
+			return err
+		}
+		event = &extra
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func extraEventLockKey(now time.Time) string {
+	return "checkinfp:extra_event:" + eventDate(now).Format("2006-01-02")
+}
+
+func ListEvents(c *gin.Context, db *gorm.DB) {
+	query := db.Order("start_time DESC")
+	if from := c.Query("from"); from != "" {
+		query = query.Where("date >= ?", from)
+	}
+	if to := c.Query("to"); to != "" {
+		query = query.Where("date <= ?", to)
+	}
+
+	var events []models.Event
+	if err := query.Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar eventos"})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+func GetEvent(c *gin.Context, db *gorm.DB) {
+	var event models.Event
+	if err := db.First(&event, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Evento não encontrado"})
+		return
+	}
+
+	var totalCheckins int64
+	if err := db.Model(&models.VolunteerCheckin{}).Where("event_id = ?", event.ID).Count(&totalCheckins).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar check-ins"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"event":          event,
+		"total_checkins": totalCheckins,
+	})
+}
+
+func CreateEvent(c *gin.Context, db *gorm.DB) {
+	var input eventInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Title == nil || input.StartTime == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	event := models.Event{
+		Title:     *input.Title,
+		Date:      eventDate(*input.StartTime),
+		StartTime: *input.StartTime,
+	}
+	if input.Location != nil {
+		event.Location = *input.Location
+	}
+	if input.ExpectedTeams != nil {
+		event.ExpectedTeams = *input.ExpectedTeams
+	}
+
+	if err := db.Create(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao cadastrar evento"})
+		return
+	}
+	c.JSON(http.StatusCreated, event)
+}
+
+func UpdateEvent(c *gin.Context, db *gorm.DB) {
+	var event models.Event
+	if err := db.First(&event, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Evento não encontrado"})
+		return
+	}
+
+	var input eventInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	if input.Title != nil {
+		event.Title = *input.Title
+	}
+	if input.StartTime != nil {
+		event.StartTime = *input.StartTime
+		event.Date = eventDate(*input.StartTime)
+	}
+	if input.Location != nil {
+		event.Location = *input.Location
+	}
+	if input.ExpectedTeams != nil {
+		event.ExpectedTeams = *input.ExpectedTeams
+	}
+
+	if err := db.Save(&event).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar evento"})
+		return
+	}
+	c.JSON(http.StatusOK, event)
+}
+
+func DeleteEvent(c *gin.Context, db *gorm.DB) {
+	var count int64
+	if err := db.Model(&models.VolunteerCheckin{}).Where("event_id = ?", c.Param("id")).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar check-ins"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": "Evento já possui check-ins e não pode ser removido"})
+		return
+	}
+
+	result := db.Delete(&models.Event{}, "id = ?", c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover evento"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Evento não encontrado"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Evento removido com sucesso"})
+}
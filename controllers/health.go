@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+// HealthCheck verifica a conexão com o banco e com o cache.
+// O tempo limite de cada verificação vem de HEALTH_CHECK_TIMEOUT (padrão 2s).
+// A rota é pública: os detalhes das falhas vão só para o log.
+func HealthCheck(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), utils.EnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second))
+	defer cancel()
+
+	status := http.StatusOK
+	checks := gin.H{"database": "ok", "cache": "ok"}
+
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		status = http.StatusServiceUnavailable
+		checks["database"] = "down"
+		log.Printf("Health check: banco indisponível: %v", err)
+	}
+
+	if err := cache.Ping(ctx); err != nil {
+		status = http.StatusServiceUnavailable
+		checks["cache"] = "down"
+		log.Printf("Health check: cache indisponível: %v", err)
+	}
+
+	c.JSON(status, checks)
+}
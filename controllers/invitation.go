@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+var errInvitationUnavailable = errors.New("convite inválido, expirado ou já utilizado")
+
+// findPendingInvitation busca o convite do token que ainda pode ser aceito.
+func findPendingInvitation(db *gorm.DB, token string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := db.Where("token_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?",
+		utils.HashToken(token), time.Now()).First(&invitation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvitationUnavailable
+	}
+	return &invitation, err
+}
+
+// CreateInvitation convida um voluntário por e-mail, já com as funções definidas.
+// Convites pendentes anteriores para o mesmo e-mail são cancelados. O link também
+// volta na resposta, para ser compartilhado por outros meios (ex.: WhatsApp).
+func CreateInvitation(c *gin.Context, db *gorm.DB, mailer utils.Mailer) {
+	inviterIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return
+	}
+	inviterID := inviterIDVal.(uuid.UUID)
+
+	var input struct {
+		Email         string   `json:"email"`
+		Roles         []string `json:"roles"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "E-mail inválido"})
+		return
+	}
+	if input.ExpiresInDays <= 0 {
+		input.ExpiresInDays = 7
+	}
+	if input.ExpiresInDays > 30 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "O convite pode valer no máximo 30 dias"})
+		return
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).Where("LOWER(email) = ?", email).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuários"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": "*E-mail já cadastrado, irmão(ã)"})
+		return
+	}
+
+	roles, err := normalizeRoles(db, input.Roles, nil)
+	if err != nil {
+		respondRolesError(c, err)
+		return
+	}
+
+	var inviter models.User
+	if err := db.First(&inviter, "id = ?", inviterID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+
+	token := utils.GenerateRandomToken() + utils.GenerateRandomToken()
+	invitation := models.Invitation{
+		Email:     email,
+		Roles:     roles,
+		TokenHash: utils.HashToken(token),
+		InvitedBy: inviterID,
+		ExpiresAt: time.Now().AddDate(0, 0, input.ExpiresInDays),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Invitation{}).
+			Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL", email).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criar convite"})
+		return
+	}
+
+	location := utils.SaoPaulo
+	link := utils.FrontendURL("/signup/invite", url.Values{"token": {token}})
+	err = utils.SendTemplate(c.Request.Context(), mailer, "invitation", email, gin.H{
+		"InviterName": inviter.Name,
+		"Link":        link,
+		"ExpiresAt":   invitation.ExpiresAt.In(location).Format("02/01/2006 às 15:04"),
+	})
+	emailSent := err == nil
+	if err != nil {
+		log.Printf("Erro ao enviar convite para %s: %v", email, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation": invitation,
+		"link":       link,
+		"email_sent": emailSent,
+	})
+}
+
+// ListInvitations lista os convites; com ?status=pending, só os que ainda podem ser aceitos.
+func ListInvitations(c *gin.Context, db *gorm.DB) {
+	query := db.Order("created_at DESC")
+	if c.Query("status") == "pending" {
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now())
+	}
+
+	var invitations []models.Invitation
+	if err := query.Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar convites"})
+		return
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation cancela um convite ainda não aceito.
+func RevokeInvitation(c *gin.Context, db *gorm.DB) {
+	result := db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", c.Param("id")).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao cancelar convite"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Convite não encontrado ou já utilizado"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Convite cancelado com sucesso"})
+}
+
+// GetInvitation mostra os dados do convite para a tela de cadastro preencher o e-mail.
+func GetInvitation(c *gin.Context, db *gorm.DB) {
+	invitation, err := findPendingInvitation(db, c.Query("token"))
+	if err != nil {
+		if errors.Is(err, errInvitationUnavailable) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Convite inválido, expirado ou já utilizado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar convite"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"email":      invitation.Email,
+		"roles":      invitation.Roles,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// SignUpWithInvite cria a conta a partir de um convite: o e-mail e as funções vêm
+// do convite, e o voluntário já entra aprovado e com o e-mail confirmado.
+func SignUpWithInvite(c *gin.Context, db *gorm.DB) {
+	var input struct {
+		Token    string `json:"token"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.Token == "" || input.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	if len(strings.Fields(input.Name)) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "*Por favor, informe seu nome completo, varão(oa)"})
+		return
+	}
+
+	invitation, err := findPendingInvitation(db, input.Token)
+	if err != nil {
+		if errors.Is(err, errInvitationUnavailable) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Convite inválido, expirado ou já utilizado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar convite"})
+		return
+	}
+
+	if err := utils.ValidatePassword(input.Password, input.Name, invitation.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criptografar senha"})
+		return
+	}
+
+	now := time.Now()
+	user := models.User{
+		Name:            input.Name,
+		Email:           invitation.Email,
+		Password:        hashedPassword,
+		Roles:           invitation.Roles,
+		Status:          models.UserStatusApproved,
+		EmailVerifiedAt: &now,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		// A condição em accepted_at garante que o convite só seja usado uma vez
+		result := tx.Model(invitation).
+			Where("accepted_at IS NULL AND revoked_at IS NULL").
+			Updates(map[string]interface{}{"accepted_at": now, "accepted_by": user.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitationUnavailable
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvitationUnavailable):
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Convite inválido, expirado ou já utilizado"})
+		case utils.IsDuplicateKeyError(err):
+			c.JSON(http.StatusBadRequest, gin.H{"message": "*E-mail já cadastrado, irmão(ã)"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criar conta"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Voluntário criado com sucesso! Bem-vindo(a) ao ministério"})
+}
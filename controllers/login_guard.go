@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+// Mensagem única para e-mail inexistente e senha errada, para não revelar quais
+// e-mails estão cadastrados.
+const loginFailedMessage = "*E-mail ou senha inválidos, irmão(ã)"
+
+type loginLimits struct {
+	MaxAccountAttempts int
+	MaxIPAttempts      int
+	Window             time.Duration
+	Lockout            time.Duration
+}
+
+func loadLoginLimits() loginLimits {
+	return loginLimits{
+		MaxAccountAttempts: utils.EnvInt("LOGIN_MAX_ATTEMPTS", 5),
+		MaxIPAttempts:      utils.EnvInt("LOGIN_IP_MAX_ATTEMPTS", 20),
+		Window:             utils.EnvDuration("LOGIN_ATTEMPT_WINDOW", 15*time.Minute),
+		Lockout:            utils.EnvDuration("LOGIN_LOCKOUT", 15*time.Minute),
+	}
+}
+
+func loginAccountKey(email string) string {
+	return fmt.Sprintf("checkinfp:login_fail:user:%s", email)
+}
+
+func loginIPKey(ip string) string {
+	return fmt.Sprintf("checkinfp:login_fail:ip:%s", ip)
+}
+
+func loginLockKey(email string) string {
+	return fmt.Sprintf("checkinfp:login_lock:%s", email)
+}
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// compareDummyPassword gasta o mesmo tempo de um bcrypt real quando o e-mail não
+// existe, para que o tempo de resposta não revele se a conta está cadastrada.
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = utils.HashPassword("checkinfp-dummy-password")
+	})
+	utils.CheckPasswordHash(password, dummyHash)
+}
+
+// loginBlocked verifica, antes de conferir a senha, se a conta está bloqueada ou se
+// o IP passou do limite de tentativas. Retorna quanto tempo falta para liberar.
+func loginBlocked(cache utils.Cache, limits loginLimits, email, ip string) (bool, time.Duration) {
+	if ttl, err := cache.TTL(utils.Ctx, loginLockKey(email)); err != nil {
+		log.Printf("Erro ao consultar bloqueio de login: %v", err)
+	} else if ttl > 0 || ttl == -1 {
+		return true, ttl
+	}
+
+	val, err := cache.Get(utils.Ctx, loginIPKey(ip))
+	if err != nil {
+		return false, 0
+	}
+	if attempts, _ := strconv.Atoi(val); attempts >= limits.MaxIPAttempts {
+		ttl, _ := cache.TTL(utils.Ctx, loginIPKey(ip))
+		return true, ttl
+	}
+	return false, 0
+}
+
+// registerLoginFailure conta a tentativa errada no IP e na conta e bloqueia a
+// conta ao atingir o limite. Retorna quantas falhas a conta acumula na janela.
+func registerLoginFailure(cache utils.Cache, limits loginLimits, email, ip string) int64 {
+	if _, err := cache.Incr(utils.Ctx, loginIPKey(ip), limits.Window); err != nil {
+		log.Printf("Erro ao registrar tentativa de login do IP %s: %v", ip, err)
+	}
+
+	failures, err := cache.Incr(utils.Ctx, loginAccountKey(email), limits.Window)
+	if err != nil {
+		log.Printf("Erro ao registrar tentativa de login de %s: %v", email, err)
+		return 0
+	}
+	if failures >= int64(limits.MaxAccountAttempts) {
+		log.Printf("Conta %s bloqueada por %s após %d tentativas de login", email, limits.Lockout, failures)
+		if err := cache.Set(utils.Ctx, loginLockKey(email), "1", limits.Lockout); err != nil {
+			log.Printf("Erro ao bloquear login de %s: %v", email, err)
+		}
+		_ = cache.Del(utils.Ctx, loginAccountKey(email))
+	}
+	return failures
+}
+
+// loginFailureDelay cresce a cada tentativa errada: nada nas duas primeiras,
+// depois 1s, 2s, 4s... até 8s.
+func loginFailureDelay(failures int64) time.Duration {
+	if failures < 3 {
+		return 0
+	}
+	delay := time.Duration(math.Pow(2, float64(failures-3))) * time.Second
+	if delay > 8*time.Second {
+		delay = 8 * time.Second
+	}
+	return delay
+}
+
+// respondLoginFailure registra a falha e responde com a mensagem informada, depois
+// do atraso progressivo.
+func respondLoginFailure(c *gin.Context, cache utils.Cache, limits loginLimits, email, message string) {
+	failures := registerLoginFailure(cache, limits, email, c.ClientIP())
+	select {
+	case <-time.After(loginFailureDelay(failures)):
+	case <-c.Request.Context().Done():
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"message": message})
+}
+
+func respondLoginBlocked(c *gin.Context, retryAfter time.Duration) {
+	minutes := int(math.Ceil(retryAfter.Minutes()))
+	if minutes < 1 {
+		minutes = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"message": fmt.Sprintf("Muitas tentativas de login. Tente novamente em %d minuto(s)", minutes),
+	})
+}
+
+// UnlockLogin libera uma conta bloqueada por excesso de tentativas de login.
+func UnlockLogin(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+
+	email := normalizeLoginEmail(user.Email)
+	if err := cache.Del(utils.Ctx, loginLockKey(email), loginAccountKey(email)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao desbloquear conta"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Conta desbloqueada com sucesso"})
+}
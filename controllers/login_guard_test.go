@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/utils"
+)
+
+var testLoginLimits = loginLimits{
+	MaxAccountAttempts: 3,
+	MaxIPAttempts:      5,
+	Window:             time.Minute,
+	Lockout:            10 * time.Minute,
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	cache := utils.NewMemoryCache()
+	const email, ip = "voluntario@example.com", "203.0.113.1"
+
+	for i := 1; i < testLoginLimits.MaxAccountAttempts; i++ {
+		registerLoginFailure(cache, testLoginLimits, email, ip)
+		if blocked, _ := loginBlocked(cache, testLoginLimits, email, ip); blocked {
+			t.Fatalf("conta bloqueada após %d tentativas, limite %d", i, testLoginLimits.MaxAccountAttempts)
+		}
+	}
+	registerLoginFailure(cache, testLoginLimits, email, ip)
+
+	blocked, retryAfter := loginBlocked(cache, testLoginLimits, email, ip)
+	if !blocked {
+		t.Fatal("conta não bloqueada ao atingir o limite")
+	}
+	if retryAfter <= 0 || retryAfter > testLoginLimits.Lockout {
+		t.Errorf("retryAfter = %s, esperado até %s", retryAfter, testLoginLimits.Lockout)
+	}
+	if blocked, _ := loginBlocked(cache, testLoginLimits, "outro@example.com", "203.0.113.2"); blocked {
+		t.Error("bloqueio de uma conta afetou outra")
+	}
+
+	// O desbloqueio (UnlockLogin) apaga as mesmas chaves
+	if err := cache.Del(utils.Ctx, loginLockKey(email), loginAccountKey(email)); err != nil {
+		t.Fatal(err)
+	}
+	if blocked, _ := loginBlocked(cache, testLoginLimits, email, ip); blocked {
+		t.Error("conta continua bloqueada depois do desbloqueio")
+	}
+}
+
+func TestLoginIPLimit(t *testing.T) {
+	cache := utils.NewMemoryCache()
+	const ip = "203.0.113.1"
+
+	// Cada tentativa usa uma conta diferente, como num ataque de força bruta espalhado
+	for i := 0; i < testLoginLimits.MaxIPAttempts; i++ {
+		registerLoginFailure(cache, testLoginLimits, string(rune('a'+i))+"@example.com", ip)
+	}
+	if blocked, _ := loginBlocked(cache, testLoginLimits, "nova@example.com", ip); !blocked {
+		t.Error("IP não bloqueado ao atingir o limite")
+	}
+	if blocked, _ := loginBlocked(cache, testLoginLimits, "nova@example.com", "203.0.113.2"); blocked {
+		t.Error("bloqueio de um IP afetou outro")
+	}
+}
+
+func TestLoginFailureDelay(t *testing.T) {
+	tests := []struct {
+		failures int64
+		delay    time.Duration
+	}{
+		{0, 0}, {2, 0}, {3, time.Second}, {4, 2 * time.Second}, {5, 4 * time.Second}, {6, 8 * time.Second}, {20, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := loginFailureDelay(tt.failures); got != tt.delay {
+			t.Errorf("loginFailureDelay(%d) = %s, esperado %s", tt.failures, got, tt.delay)
+		}
+	}
+}
+
+func TestRespondLoginBlocked(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	respondLoginBlocked(c, 90*time.Second)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, esperado 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("Retry-After = %q, esperado 90", got)
+	}
+}
+
+func TestUnlockLogin(t *testing.T) {
+	db := testDB(t)
+	cache := utils.NewMemoryCache()
+	user := createTestUser(t, db)
+	email := normalizeLoginEmail(user.Email)
+
+	for i := 0; i < testLoginLimits.MaxAccountAttempts; i++ {
+		registerLoginFailure(cache, testLoginLimits, email, "203.0.113.1")
+	}
+	if blocked, _ := loginBlocked(cache, testLoginLimits, email, "203.0.113.9"); !blocked {
+		t.Fatal("conta não bloqueada")
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: user.ID.String()}}
+	UnlockLogin(c, db, cache)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, esperado 200", w.Code)
+	}
+	if blocked, _ := loginBlocked(cache, testLoginLimits, email, "203.0.113.9"); blocked {
+		t.Error("conta continua bloqueada depois do desbloqueio")
+	}
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// As chaves do auth são lidas uma única vez; precisam estar definidas antes do primeiro teste
+	os.Setenv("JWT_KEYS", "")
+	os.Setenv("JWT_ACTIVE_KID", "")
+	os.Setenv("JWT_SECRET", "segredo-de-teste")
+	os.Exit(m.Run())
+}
+
+// testDB abre o Postgres de TEST_DATABASE_URL e aplica as migrations. Sem a
+// variável, o teste é pulado: não há banco embutido para rodar as consultas.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL não definido")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Erro ao conectar com o banco de testes: %v", err)
+	}
+	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`).Error; err != nil {
+		t.Fatalf("Erro ao criar extensão uuid-ossp: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("Erro ao migrar o banco de testes: %v", err)
+	}
+	return db
+}
+
+// createTestUser cadastra um voluntário com e-mail único e o apaga ao fim do teste.
+func createTestUser(t *testing.T, db *gorm.DB) models.User {
+	t.Helper()
+	user := models.User{
+		Name:     "Voluntário de Teste",
+		Email:    "teste-" + uuid.NewString() + "@example.com",
+		Password: "hash",
+		Status:   models.UserStatusApproved,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Erro ao criar usuário: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+		db.Where("user_id = ?", user.ID).Delete(&models.RefreshToken{})
+		db.Exec("DELETE FROM user_system_roles WHERE user_id = ?", user.ID)
+		db.Unscoped().Delete(&user)
+	})
+	return user
+}
@@ -1,12 +1,18 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
 	"gorm.io/gorm"
 )
 
@@ -25,16 +31,20 @@ func GetMe(c *gin.Context, db *gorm.DB) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":        user.ID,
-		"name":      user.Name,
-		"roles":     user.Roles,
-		"email":     user.Email,
-		"is_admin":  user.IsAdmin,
-		"photo_url": user.PhotoURL,
+		"id":             user.ID,
+		"name":           user.Name,
+		"roles":          user.Roles,
+		"email":          user.Email,
+		"is_admin":       user.IsAdmin,
+		"photo_url":      user.PhotoURL,
+		"email_verified": user.EmailVerifiedAt != nil,
+		"two_factor":     user.TOTPEnabledAt != nil,
 	})
 }
 
-func UpdateProfile(c *gin.Context, db *gorm.DB) {
+// UpdateProfile altera os dados do voluntário logado. Trocar e-mail ou senha exige
+// a senha atual, para que um token vazado não baste para tomar a conta.
+func UpdateProfile(c *gin.Context, db *gorm.DB, cache utils.Cache, mailer utils.Mailer) {
 	userIDVal, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
@@ -43,11 +53,12 @@ func UpdateProfile(c *gin.Context, db *gorm.DB) {
 	userID := userIDVal.(uuid.UUID)
 
 	var input struct {
-		Name     *string   `json:"name"`
-		Email    *string   `json:"email"`
-		Password *string   `json:"password"`
-		Roles    *[]string `json:"roles"`
-		PhotoURL *string   `json:"photo_url"`
+		Name            *string   `json:"name"`
+		Email           *string   `json:"email"`
+		Password        *string   `json:"password"`
+		CurrentPassword string    `json:"current_password"`
+		Roles           *[]string `json:"roles"`
+		PhotoURL        *string   `json:"photo_url"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -61,6 +72,17 @@ func UpdateProfile(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	if (input.Email != nil && *input.Email != user.Email) || input.Password != nil {
+		if input.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "*Informe sua senha atual para alterar e-mail ou senha, irmão(ã)"})
+			return
+		}
+		if !utils.CheckPasswordHash(input.CurrentPassword, user.Password) {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "*Senha atual incorreta, irmão(ã)"})
+			return
+		}
+	}
+
 	if input.Name != nil {
 		if len(strings.Fields(*input.Name)) < 2 {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "*Por favor, informe seu nome completo, varão(oa)"})
@@ -68,6 +90,8 @@ func UpdateProfile(c *gin.Context, db *gorm.DB) {
 		}
 		user.Name = *input.Name
 	}
+	emailChanged := false
+	oldEmail := user.Email
 	if input.Email != nil && *input.Email != user.Email {
 		var existingUser models.User
 		if err := db.Where("email = ?", *input.Email).First(&existingUser).Error; err == nil {
@@ -75,15 +99,26 @@ func UpdateProfile(c *gin.Context, db *gorm.DB) {
 			return
 		}
 		user.Email = *input.Email
+		user.EmailVerifiedAt = nil
+		emailChanged = true
 	}
 	if input.Roles != nil {
-		user.Roles = *input.Roles
+		roles, err := normalizeRoles(db, *input.Roles, user.Roles)
+		if err != nil {
+			respondRolesError(c, err)
+			return
+		}
+		user.Roles = roles
 	}
 	if input.PhotoURL != nil {
 		user.PhotoURL = *input.PhotoURL
 	}
 	if input.Password != nil {
-		hashedPassword, err := HashPassword(*input.Password)
+		if err := utils.ValidatePassword(*input.Password, user.Name, user.Email); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		hashedPassword, err := utils.HashPassword(*input.Password)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criptografar senha"})
 			return
@@ -95,6 +130,112 @@ func UpdateProfile(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar perfil"})
 		return
 	}
+	if input.Password != nil {
+		if err := invalidatePasswordResetTokens(db, user.ID); err != nil {
+			log.Printf("Erro ao invalidar links de redefinição do usuário %s: %v", user.ID, err)
+		}
+		// Só a sessão que trocou a senha continua ativa
+		sessionID, _ := c.Get("session_id")
+		if err := revokeOtherSessions(db, cache, user.ID, sessionID.(uuid.UUID)); err != nil {
+			log.Printf("Erro ao encerrar outras sessões do usuário %s: %v", user.ID, err)
+		}
+	}
+	if emailChanged {
+		if err := sendVerificationEmail(c, db, mailer, user); err != nil {
+			log.Printf("Erro ao enviar e-mail de confirmação para %s: %v", user.Email, err)
+		}
+		// Avisa o endereço antigo, caso a troca não tenha sido feita pelo dono da conta
+		location := utils.SaoPaulo
+		err := utils.SendTemplate(c.Request.Context(), mailer, "email_changed", oldEmail, gin.H{
+			"Name":      user.Name,
+			"NewEmail":  user.Email,
+			"ChangedAt": time.Now().In(location).Format("02/01/2006 às 15:04"),
+		})
+		if err != nil {
+			log.Printf("Erro ao avisar %s sobre a troca de e-mail: %v", oldEmail, err)
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Perfil atualizado com sucesso"})
 }
+
+const (
+	maxProfilePhotoBytes = 5 << 20 // 5 MB
+	// Folga para os cabeçalhos e delimitadores do multipart em volta da foto
+	multipartOverheadBytes = 64 << 10
+)
+
+func UploadProfilePhoto(c *gin.Context, db *gorm.DB, store utils.Storage) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return
+	}
+	userID := userIDVal.(uuid.UUID)
+
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Armazenamento de arquivos não configurado"})
+		return
+	}
+
+	// Limita o corpo antes de ler o multipart, para não receber uploads de qualquer tamanho
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxProfilePhotoBytes+multipartOverheadBytes)
+	fileHeader, err := c.FormFile("photo")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "A foto deve ter no máximo 5 MB"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Envie a foto no campo photo"})
+		return
+	}
+	if fileHeader.Size > maxProfilePhotoBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "A foto deve ter no máximo 5 MB"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Erro ao ler a foto"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxProfilePhotoBytes+1))
+	if err != nil || len(data) > maxProfilePhotoBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Erro ao ler a foto"})
+		return
+	}
+
+	photo, err := utils.ProcessProfilePhoto(data, 512)
+	if errors.Is(err, utils.ErrImageTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "A foto deve ter no máximo 40 megapixels"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Formato de imagem inválido, envie JPEG, PNG ou GIF"})
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+
+	key := fmt.Sprintf("profile/%s-%d.jpg", user.ID, time.Now().Unix())
+	url, err := store.Save(c.Request.Context(), key, "image/jpeg", photo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar a foto"})
+		return
+	}
+
+	user.PhotoURL = url
+	if err := db.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar perfil"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"photo_url": user.PhotoURL})
+}
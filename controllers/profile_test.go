@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type discardStorage struct{}
+
+func (discardStorage) Save(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	return "https://example.com/" + key, nil
+}
+
+func TestUploadProfilePhotoRejectsLargeBodies(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("photo", "foto.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte{0}, maxProfilePhotoBytes+multipartOverheadBytes))
+	form.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/me/photo", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	c.Set("user_id", uuid.New())
+
+	// O corpo é recusado antes de qualquer consulta ao banco
+	UploadProfilePhoto(c, nil, discardStorage{})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, esperado 413", w.Code)
+	}
+}
@@ -1,35 +1,89 @@
 package controllers
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
 	"github.com/nicolaslucianob/checkinfp/utils"
 	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
 )
 
-func GenerateQRCode(c *gin.Context) {
-	client := utils.NewRedisClient()
+// qrTokenRecord é o valor salvo em checkinfp:token:<token>: o evento ao qual o
+// token pertence, quem o emitiu e a janela em que ele é aceito no check-in.
+type qrTokenRecord struct {
+	EventID    string    `json:"event_id"`
+	IssuedBy   string    `json:"issued_by"`
+	ValidFrom  time.Time `json:"valid_from"`
+	ValidUntil time.Time `json:"valid_until"`
+}
+
+// qrTokenGracePeriod mantém o token no cache depois do fim da janela de validade,
+// para que o check-in responda token_expired em vez de token_invalid.
+const qrTokenGracePeriod = time.Hour
+
+func parseWindowParam(c *gin.Context, name string, fallback time.Time) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func buildScanURL(token string) string {
+	host := os.Getenv("FRONT_HOST")
+	scheme := "https"
+	return fmt.Sprintf("%s://%s/checkin?token=%s", scheme, host, token)
+}
+
+func GenerateQRCode(c *gin.Context, db *gorm.DB, cache utils.Cache, store utils.Storage) {
+	mode := c.DefaultQuery("mode", "static")
+	if mode != "static" && mode != "rotating" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Modo inválido, use static ou rotating"})
+		return
+	}
 
 	qrKey := "checkinfp:qr_code_current"
 
 	// 1. Tenta pegar QR Code salvo
-	existing, err := client.HGetAll(utils.Ctx, qrKey).Result()
-	if err == nil && len(existing) > 0 {
-		ttl, _ := client.TTL(utils.Ctx, qrKey).Result()
+	existing, err := cache.HGetAll(utils.Ctx, qrKey)
+	requestedEvent := c.Query("event_id")
+	existingMode := existing["mode"]
+	if existingMode == "" {
+		existingMode = "static"
+	}
+	if err == nil && len(existing) > 0 && existingMode == mode && (requestedEvent == "" || requestedEvent == existing["event_id"]) {
+		if mode == "rotating" {
+			if session, err := loadRotatingSession(cache, existing["event_id"]); err == nil {
+				payload, err := rotatingPayload(session, time.Now())
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR Code"})
+					return
+				}
+				c.JSON(http.StatusOK, payload)
+				return
+			}
+		}
+
+		ttl, _ := cache.TTL(utils.Ctx, qrKey)
 		if ttl > 0 && existing["url"] != "" && existing["token"] != "" {
 			hours := int(ttl.Hours())
 			minutes := int(ttl.Minutes()) % 60
 			seconds := int(ttl.Seconds()) % 60
 
 			c.JSON(http.StatusOK, gin.H{
+				"mode":       "static",
 				"url":        existing["url"],
 				"token":      existing["token"],
+				"event_id":   existing["event_id"],
 				"expires_in": fmt.Sprintf("%02dh:%02dm:%02ds", hours, minutes, seconds),
 				"expires_at": time.Now().Add(ttl).UnixMilli(),
 			})
@@ -37,64 +91,165 @@ func GenerateQRCode(c *gin.Context) {
 		}
 	}
 
-	defer client.Close()
+	// 2. Resolve o evento ao qual os check-ins deste QR Code serão vinculados
+	var event *models.Event
+	if requestedEvent != "" {
+		var found models.Event
+		if err := db.First(&found, "id = ?", requestedEvent).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Evento não encontrado"})
+			return
+		}
+		event = &found
+	} else {
+		event, err = ensureCurrentEvent(db, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar evento atual"})
+			return
+		}
+	}
+	eventID := ""
+	if event != nil {
+		eventID = event.ID.String()
+	}
 
-	token := utils.GenerateRandomToken()
-	// Salva o token no Redis com expiração de 3 horas.
-	redisTokenKey := fmt.Sprintf("checkinfp:token:%s", token)
-	err = client.Set(utils.Ctx, redisTokenKey, "valid", 3*time.Hour).Err()
+	// 3. Janela de validade: por padrão, de agora até 1h depois do início do evento
+	// (ou 3 horas, quando não há evento).
+	now := time.Now()
+	defaultUntil := now.Add(3 * time.Hour)
+	if event != nil {
+		defaultUntil = event.StartTime.Add(time.Hour)
+	}
+	validFrom, err := parseWindowParam(c, "valid_from", now)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar token no cache"})
+		c.JSON(http.StatusBadRequest, gin.H{"message": "valid_from inválido, use o formato RFC3339"})
+		return
+	}
+	validUntil, err := parseWindowParam(c, "valid_until", defaultUntil)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "valid_until inválido, use o formato RFC3339"})
+		return
+	}
+	if !validUntil.After(now) || !validUntil.After(validFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Janela de validade do QR Code inválida"})
 		return
 	}
+	expiry := validUntil.Sub(now)
 
-	host := os.Getenv("FRONT_HOST")
-	scheme := "https"
-	scanURL := fmt.Sprintf("%s://%s/checkin?token=%s", scheme, host, token)
-	log.Printf("QR Code gerado com URL: %s", scanURL)
+	issuedBy := ""
+	if userIDVal, exists := c.Get("user_id"); exists {
+		issuedBy = fmt.Sprint(userIDVal)
+	}
+	tokenRecord := qrTokenRecord{
+		EventID:    eventID,
+		IssuedBy:   issuedBy,
+		ValidFrom:  validFrom,
+		ValidUntil: validUntil,
+	}
+
+	// 4. Modo rotativo: salva só a sessão do evento; os códigos são derivados do tempo.
+	if mode == "rotating" {
+		if event == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "O QR Code rotativo precisa de um evento"})
+			return
+		}
+		interval := 30
+		if value := c.Query("interval"); value != "" {
+			if _, err := fmt.Sscan(value, &interval); err != nil || interval < 10 || interval > 300 {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Intervalo inválido (entre 10 e 300 segundos)"})
+				return
+			}
+		}
+
+		session := rotatingSession{qrTokenRecord: tokenRecord, Interval: interval, Nonce: utils.GenerateRandomToken()}
+		if session.Nonce == "" {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token"})
+			return
+		}
+		sessionJSON, err := json.Marshal(session)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token"})
+			return
+		}
+		if err := cache.Set(utils.Ctx, rotatingSessionKey(eventID), string(sessionJSON), expiry+qrTokenGracePeriod); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar token no cache"})
+			return
+		}
+
+		_ = cache.HSet(utils.Ctx, qrKey, map[string]string{
+			"mode":     "rotating",
+			"event_id": eventID,
+		}, expiry)
 
-	filename := fmt.Sprintf("qr-%s.png", token)
-	err = qrcode.WriteFile(scanURL, qrcode.Medium, 256, filename)
+		payload, err := rotatingPayload(&session, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR Code"})
+			return
+		}
+		c.JSON(http.StatusOK, payload)
+		return
+	}
+
+	record, err := json.Marshal(tokenRecord)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR Code"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token"})
 		return
 	}
 
-	file, err := os.Open(filename)
+	token := utils.GenerateRandomToken()
+	// Salva o token no Redis até o fim da janela de validade, mais a tolerância.
+	redisTokenKey := fmt.Sprintf("checkinfp:token:%s", token)
+	err = cache.Set(utils.Ctx, redisTokenKey, string(record), expiry+qrTokenGracePeriod)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao abrir QR Code"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar token no cache"})
 		return
 	}
-	defer file.Close()
 
-	url, err := utils.UploadToCloudinary(filename, strings.TrimSuffix(filename, ".png"))
+	scanURL := buildScanURL(token)
+	log.Printf("QR Code gerado com URL: %s", scanURL)
+
+	png, err := qrcode.Encode(scanURL, qrcode.Medium, 256)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao enviar QR Code para o Cloudinary"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR Code"})
 		return
 	}
-	os.Remove(filename)
 
-	_ = client.HSet(utils.Ctx, qrKey, map[string]interface{}{
-		"url":   url,
-		"token": token,
-	}).Err()
-	_ = client.Expire(utils.Ctx, qrKey, 3*time.Hour).Err()
+	// O storage é só um espelho: se estiver fora do ar, a imagem segue
+	// disponível em /generate/qr/image e como data URI.
+	url := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	if store != nil {
+		mirrored, err := store.Save(c.Request.Context(), fmt.Sprintf("qr/qr-%s.png", token), "image/png", png)
+		if err != nil {
+			log.Printf("Falha ao espelhar QR Code no storage: %v", err)
+		} else {
+			url = mirrored
+		}
+	}
+
+	_ = cache.HSet(utils.Ctx, qrKey, map[string]string{
+		"mode":     "static",
+		"url":      url,
+		"token":    token,
+		"event_id": eventID,
+	}, expiry)
 
-	expiry := 3 * time.Hour
 	c.JSON(http.StatusOK, gin.H{
-		"url":        url,
-		"token":      token,
-		"expires_in": fmt.Sprintf("%02dh:%02dm:%02ds", int(expiry.Hours()), int(expiry.Minutes())%60, int(expiry.Seconds())%60),
-		"expires_at": time.Now().Add(expiry).UnixMilli(),
+		"mode":        "static",
+		"url":         url,
+		"token":       token,
+		"event_id":    eventID,
+		"valid_from":  validFrom,
+		"valid_until": validUntil,
+		"expires_in":  fmt.Sprintf("%02dh:%02dm:%02ds", int(expiry.Hours()), int(expiry.Minutes())%60, int(expiry.Seconds())%60),
+		"expires_at":  validUntil.UnixMilli(),
 	})
 }
 
-func RegenerateQRCode(c *gin.Context) {
-	client := utils.NewRedisClient()
-	defer client.Close()
-
+func RegenerateQRCode(c *gin.Context, cache utils.Cache) {
 	qrKey := "checkinfp:qr_code_current"
-	err := client.Del(utils.Ctx, qrKey).Err()
+	if current, err := cache.HGetAll(utils.Ctx, qrKey); err == nil && current["mode"] == "rotating" {
+		_ = cache.Del(utils.Ctx, rotatingSessionKey(current["event_id"]))
+	}
+	err := cache.Del(utils.Ctx, qrKey)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao deletar QR Code do cache"})
 		return
@@ -102,3 +257,65 @@ func RegenerateQRCode(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "QR Code resetado com sucesso"})
 }
+
+// GetQRCodeImage renderiza em memória a imagem do QR Code atual (PNG ou SVG),
+// sem depender do storage.
+func GetQRCodeImage(c *gin.Context, cache utils.Cache) {
+	format := c.DefaultQuery("format", "png")
+	if format != "png" && format != "svg" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Formato inválido, use png ou svg"})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", "256"))
+	if err != nil || size < 64 || size > 2048 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Tamanho inválido (entre 64 e 2048 pixels)"})
+		return
+	}
+
+	level, ok := utils.ParseQRLevel(c.Query("level"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Nível de correção inválido, use low, medium, high ou highest"})
+		return
+	}
+
+	current, err := cache.HGetAll(utils.Ctx, "checkinfp:qr_code_current")
+	if err != nil || len(current) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Nenhum QR Code ativo"})
+		return
+	}
+
+	token := current["token"]
+	if current["mode"] == "rotating" {
+		session, err := loadRotatingSession(cache, current["event_id"])
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Nenhum QR Code ativo"})
+			return
+		}
+		token = rotatingToken(session, utils.RotatingStep(time.Now(), session.interval()))
+	}
+	if token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Nenhum QR Code ativo"})
+		return
+	}
+
+	scanURL := buildScanURL(token)
+	c.Header("Cache-Control", "no-store")
+
+	if format == "svg" {
+		svg, err := utils.QRCodeSVG(scanURL, level, size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR Code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", []byte(svg))
+		return
+	}
+
+	png, err := qrcode.Encode(scanURL, level, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR Code"})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", png)
+}
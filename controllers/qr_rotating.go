@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"github.com/skip2/go-qrcode"
+)
+
+const rotatingTokenPrefix = "rot."
+
+// rotatingSession é o valor salvo em checkinfp:rotating:<eventID> quando o QR
+// rotativo de um evento é gerado. Os códigos em si não ficam no Redis: são
+// recalculados a partir do evento e do passo de tempo.
+type rotatingSession struct {
+	qrTokenRecord
+	Interval int    `json:"interval"`
+	Nonce    string `json:"nonce"`
+}
+
+func (s rotatingSession) interval() time.Duration {
+	return time.Duration(s.Interval) * time.Second
+}
+
+func rotatingSessionKey(eventID string) string {
+	return fmt.Sprintf("checkinfp:rotating:%s", eventID)
+}
+
+func rotatingToken(session *rotatingSession, step int64) string {
+	return rotatingTokenPrefix + session.EventID + "." + utils.RotatingCode(utils.RotatingQRSecret(), session.EventID, session.Nonce, step)
+}
+
+func isRotatingToken(token string) bool {
+	return strings.HasPrefix(token, rotatingTokenPrefix)
+}
+
+func loadRotatingSession(cache utils.Cache, eventID string) (*rotatingSession, error) {
+	val, err := cache.Get(utils.Ctx, rotatingSessionKey(eventID))
+	if err != nil {
+		return nil, err
+	}
+	var session rotatingSession
+	if err := json.Unmarshal([]byte(val), &session); err != nil {
+		return nil, err
+	}
+	if session.Interval <= 0 {
+		return nil, fmt.Errorf("intervalo inválido no QR rotativo")
+	}
+	if session.Nonce == "" {
+		return nil, fmt.Errorf("QR rotativo sem nonce")
+	}
+	return &session, nil
+}
+
+// verifyRotatingToken valida um token "rot.<eventID>.<código>", aceitando apenas
+// o código do passo atual e o do passo anterior. Depois do fim da janela, confere
+// os passos finais da sessão, para que o check-in responda token_expired.
+func verifyRotatingToken(cache utils.Cache, token string, now time.Time) (*qrTokenRecord, bool) {
+	parts := strings.Split(strings.TrimPrefix(token, rotatingTokenPrefix), ".")
+	if len(parts) != 2 {
+		return nil, false
+	}
+	eventID, code := parts[0], parts[1]
+
+	session, err := loadRotatingSession(cache, eventID)
+	if err != nil {
+		return nil, false
+	}
+
+	secret := utils.RotatingQRSecret()
+	if now.After(session.ValidUntil) {
+		now = session.ValidUntil
+	}
+	step := utils.RotatingStep(now, session.interval())
+	for _, candidate := range []int64{step, step - 1} {
+		expected := utils.RotatingCode(secret, eventID, session.Nonce, candidate)
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return &session.qrTokenRecord, true
+		}
+	}
+	return nil, false
+}
+
+func rotatingPayload(session *rotatingSession, now time.Time) (gin.H, error) {
+	interval := session.interval()
+	step := utils.RotatingStep(now, interval)
+	token := rotatingToken(session, step)
+	scanURL := buildScanURL(token)
+
+	png, err := qrcode.Encode(scanURL, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"mode":       "rotating",
+		"token":      token,
+		"scan_url":   scanURL,
+		"image":      "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		"event_id":   session.EventID,
+		"interval":   session.Interval,
+		"rotates_at": time.Unix((step+1)*int64(interval/time.Second), 0).UnixMilli(),
+		"expires_at": session.ValidUntil.UnixMilli(),
+	}, nil
+}
+
+// currentRotatingSession carrega a sessão rotativa do QR Code atual, se houver.
+func currentRotatingSession(cache utils.Cache) (*rotatingSession, error) {
+	current, err := cache.HGetAll(utils.Ctx, "checkinfp:qr_code_current")
+	if err != nil {
+		return nil, err
+	}
+	if current["mode"] != "rotating" || current["event_id"] == "" {
+		return nil, utils.ErrCacheMiss
+	}
+	return loadRotatingSession(cache, current["event_id"])
+}
+
+// GetCurrentQRCode é consultado periodicamente pela tela do projetor e devolve
+// o código vigente do QR rotativo (ou os dados do QR estático).
+func GetCurrentQRCode(c *gin.Context, cache utils.Cache) {
+	current, err := cache.HGetAll(utils.Ctx, "checkinfp:qr_code_current")
+	if err != nil || len(current) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Nenhum QR Code ativo"})
+		return
+	}
+
+	if current["mode"] != "rotating" {
+		c.JSON(http.StatusOK, gin.H{
+			"mode":     "static",
+			"url":      current["url"],
+			"token":    current["token"],
+			"event_id": current["event_id"],
+		})
+		return
+	}
+
+	session, err := loadRotatingSession(cache, current["event_id"])
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Nenhum QR Code ativo"})
+		return
+	}
+
+	payload, err := rotatingPayload(session, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR Code"})
+		return
+	}
+	c.JSON(http.StatusOK, payload)
+}
+
+// StreamQRCode envia, via Server-Sent Events, um novo QR Code a cada rotação
+// até o fim da janela de validade.
+func StreamQRCode(c *gin.Context, cache utils.Cache) {
+	session, err := currentRotatingSession(cache)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Nenhum QR Code rotativo ativo"})
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastStep := int64(-1)
+	c.Stream(func(w io.Writer) bool {
+		now := time.Now()
+		if now.After(session.ValidUntil) {
+			c.SSEvent("expired", gin.H{"event_id": session.EventID})
+			return false
+		}
+
+		if step := utils.RotatingStep(now, session.interval()); step != lastStep {
+			payload, err := rotatingPayload(session, now)
+			if err != nil {
+				return false
+			}
+			c.SSEvent("qr", payload)
+			lastStep = step
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			return true
+		}
+	})
+}
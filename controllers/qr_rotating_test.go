@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/utils"
+)
+
+func storeRotatingSession(t *testing.T, cache utils.Cache, session rotatingSession) {
+	t.Helper()
+	value, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set(utils.Ctx, rotatingSessionKey(session.EventID), string(value), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyRotatingToken(t *testing.T) {
+	cache := utils.NewMemoryCache()
+	now := time.Now()
+	session := rotatingSession{
+		qrTokenRecord: qrTokenRecord{EventID: uuid.NewString(), ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)},
+		Interval:      30,
+		Nonce:         utils.GenerateRandomToken(),
+	}
+	storeRotatingSession(t, cache, session)
+	step := utils.RotatingStep(now, session.interval())
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"passo atual", rotatingToken(&session, step), true},
+		{"passo anterior", rotatingToken(&session, step-1), true},
+		{"dois passos atrás", rotatingToken(&session, step-2), false},
+		{"passo seguinte", rotatingToken(&session, step+1), false},
+		{"código alterado", rotatingToken(&session, step)[:len(rotatingToken(&session, step))-1] + "x", false},
+		{"evento sem QR", rotatingTokenPrefix + uuid.NewString() + ".0123456789abcdef", false},
+		{"formato inválido", rotatingTokenPrefix + session.EventID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := verifyRotatingToken(cache, tt.token, now); ok != tt.ok {
+				t.Errorf("verifyRotatingToken = %v, esperado %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+// Depois de resetar e gerar de novo o QR do mesmo evento, os códigos do QR
+// anterior (fotografados, por exemplo) deixam de valer.
+func TestVerifyRotatingTokenRejectsPreviousSession(t *testing.T) {
+	cache := utils.NewMemoryCache()
+	now := time.Now()
+	record := qrTokenRecord{EventID: uuid.NewString(), ValidFrom: now.Add(-time.Hour), ValidUntil: now.Add(time.Hour)}
+
+	previous := rotatingSession{qrTokenRecord: record, Interval: 30, Nonce: utils.GenerateRandomToken()}
+	storeRotatingSession(t, cache, previous)
+	step := utils.RotatingStep(now, previous.interval())
+	oldToken := rotatingToken(&previous, step)
+
+	current := rotatingSession{qrTokenRecord: record, Interval: 30, Nonce: utils.GenerateRandomToken()}
+	storeRotatingSession(t, cache, current)
+
+	if _, ok := verifyRotatingToken(cache, oldToken, now); ok {
+		t.Error("código do QR anterior aceito depois de gerar um novo")
+	}
+	if _, ok := verifyRotatingToken(cache, rotatingToken(&current, step), now); !ok {
+		t.Error("código do QR atual recusado")
+	}
+}
+
+// Depois do fim da janela, o último código ainda é reconhecido, para que o
+// check-in responda token_expired em vez de token_invalid.
+func TestVerifyRotatingTokenAfterWindow(t *testing.T) {
+	cache := utils.NewMemoryCache()
+	end := time.Now().Add(-10 * time.Minute)
+	session := rotatingSession{
+		qrTokenRecord: qrTokenRecord{EventID: uuid.NewString(), ValidFrom: end.Add(-time.Hour), ValidUntil: end},
+		Interval:      30,
+		Nonce:         utils.GenerateRandomToken(),
+	}
+	storeRotatingSession(t, cache, session)
+
+	token := rotatingToken(&session, utils.RotatingStep(end, session.interval()))
+	record, ok := verifyRotatingToken(cache, token, time.Now())
+	if !ok {
+		t.Fatal("último código da janela não reconhecido")
+	}
+	if !time.Now().After(record.ValidUntil) {
+		t.Error("registro deveria estar fora da janela de validade")
+	}
+}
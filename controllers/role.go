@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+type roleInput struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Color       *string `json:"color"`
+	Active      *bool   `json:"active"`
+}
+
+// errInvalidRole é devolvido por normalizeRoles quando uma função não está no catálogo.
+type errInvalidRole struct {
+	Role string
+}
+
+func (e errInvalidRole) Error() string {
+	return fmt.Sprintf("Função inválida: %s", e.Role)
+}
+
+// normalizeRoles converte as funções informadas pelo voluntário (nome ou slug,
+// com qualquer acentuação/caixa) para os slugs do catálogo, sem repetições.
+// Só são aceitas funções ativas, além das que o voluntário já tinha (current).
+func normalizeRoles(db *gorm.DB, roles []string, current models.RolesArray) (models.RolesArray, error) {
+	normalized := models.RolesArray{}
+	if len(roles) == 0 {
+		return normalized, nil
+	}
+
+	var catalog []models.Role
+	if err := db.Where("active = ?", true).Find(&catalog).Error; err != nil {
+		return nil, err
+	}
+	active := make(map[string]bool, len(catalog)+len(current))
+	for _, role := range catalog {
+		active[role.Slug] = true
+	}
+	for _, slug := range current {
+		active[slug] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range roles {
+		slug := utils.Slugify(name)
+		if !active[slug] {
+			return nil, errInvalidRole{Role: name}
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			normalized = append(normalized, slug)
+		}
+	}
+	return normalized, nil
+}
+
+// respondRolesError responde ao erro de normalizeRoles.
+func respondRolesError(c *gin.Context, err error) {
+	if invalid, ok := err.(errInvalidRole); ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": invalid.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao validar funções"})
+}
+
+// ListRoles lista o catálogo de funções; as inativas só aparecem para os admins.
+func ListRoles(c *gin.Context, db *gorm.DB, includeInactive bool) {
+	query := db.Order("name ASC")
+	if !includeInactive {
+		query = query.Where("active = ?", true)
+	}
+
+	var roles []models.Role
+	if err := query.Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar funções"})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+func CreateRole(c *gin.Context, db *gorm.DB) {
+	var input roleInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Name == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	name := strings.TrimSpace(*input.Name)
+	slug := utils.Slugify(name)
+	if slug == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Nome da função inválido"})
+		return
+	}
+
+	role := models.Role{Name: name, Slug: slug, Active: true}
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+	if input.Color != nil {
+		role.Color = *input.Color
+	}
+	if input.Active != nil {
+		role.Active = *input.Active
+	}
+
+	if err := db.Create(&role).Error; err != nil {
+		if utils.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Já existe uma função com esse nome"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao cadastrar função"})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole altera nome, descrição, cor ou status de uma função. O slug não
+// muda, pois é o valor gravado nos voluntários.
+func UpdateRole(c *gin.Context, db *gorm.DB) {
+	var role models.Role
+	if err := db.First(&role, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Função não encontrada"})
+		return
+	}
+
+	var input roleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Nome da função inválido"})
+			return
+		}
+		role.Name = name
+	}
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+	if input.Color != nil {
+		role.Color = *input.Color
+	}
+	if input.Active != nil {
+		role.Active = *input.Active
+	}
+
+	if err := db.Save(&role).Error; err != nil {
+		if utils.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Já existe uma função com esse nome"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar função"})
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole remove uma função que nenhum voluntário usa. Funções em uso devem
+// ser desativadas.
+func DeleteRole(c *gin.Context, db *gorm.DB) {
+	var role models.Role
+	if err := db.First(&role, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Função não encontrada"})
+		return
+	}
+
+	filter, _ := json.Marshal([]string{role.Slug})
+	var count int64
+	if err := db.Model(&models.User{}).Where("roles::jsonb @> ?", string(filter)).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar voluntários"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": "Função em uso por voluntários; desative-a em vez de remover"})
+		return
+	}
+
+	if err := db.Delete(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover função"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Função removida com sucesso"})
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"gorm.io/gorm"
+)
+
+type serviceScheduleInput struct {
+	Weekday   *int    `json:"weekday"`
+	StartTime *string `json:"start_time"`
+	Title     *string `json:"title"`
+	Cancelled *bool   `json:"cancelled"`
+}
+
+func validWeekday(weekday int) bool {
+	return weekday >= int(time.Sunday) && weekday <= int(time.Saturday)
+}
+
+func validStartTime(startTime string) bool {
+	_, err := time.Parse("15:04", startTime)
+	return err == nil
+}
+
+func ListServiceSchedules(c *gin.Context, db *gorm.DB) {
+	var schedules []models.ServiceSchedule
+	if err := db.Order("weekday ASC, start_time ASC").Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar horários de culto"})
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+func CreateServiceSchedule(c *gin.Context, db *gorm.DB) {
+	var input serviceScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Weekday == nil || input.StartTime == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	if !validWeekday(*input.Weekday) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dia da semana inválido (0 = domingo, 6 = sábado)"})
+		return
+	}
+	if !validStartTime(*input.StartTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Horário inválido, use o formato HH:MM"})
+		return
+	}
+
+	schedule := models.ServiceSchedule{
+		Weekday:   time.Weekday(*input.Weekday),
+		StartTime: *input.StartTime,
+	}
+	if input.Title != nil {
+		schedule.Title = *input.Title
+	}
+	if input.Cancelled != nil {
+		schedule.Cancelled = *input.Cancelled
+	}
+
+	if err := db.Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao cadastrar horário de culto"})
+		return
+	}
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func UpdateServiceSchedule(c *gin.Context, db *gorm.DB) {
+	var schedule models.ServiceSchedule
+	if err := db.First(&schedule, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Horário de culto não encontrado"})
+		return
+	}
+
+	var input serviceScheduleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	if input.Weekday != nil {
+		if !validWeekday(*input.Weekday) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Dia da semana inválido (0 = domingo, 6 = sábado)"})
+			return
+		}
+		schedule.Weekday = time.Weekday(*input.Weekday)
+	}
+	if input.StartTime != nil {
+		if !validStartTime(*input.StartTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Horário inválido, use o formato HH:MM"})
+			return
+		}
+		schedule.StartTime = *input.StartTime
+	}
+	if input.Title != nil {
+		schedule.Title = *input.Title
+	}
+	if input.Cancelled != nil {
+		schedule.Cancelled = *input.Cancelled
+	}
+
+	if err := db.Save(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar horário de culto"})
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+func DeleteServiceSchedule(c *gin.Context, db *gorm.DB) {
+	result := db.Delete(&models.ServiceSchedule{}, "id = ?", c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao remover horário de culto"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Horário de culto não encontrado"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Horário de culto removido com sucesso"})
+}
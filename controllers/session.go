@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/auth"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+var errInvalidRefreshToken = errors.New("refresh token inválido")
+
+func accessTokenTTL() time.Duration {
+	return utils.EnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+func refreshTokenTTL() time.Duration {
+	return utils.EnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// generateAccessToken gera o JWT de curta duração usado nas requisições.
+// SystemRoles do usuário precisa estar carregado.
+func generateAccessToken(db *gorm.DB, user models.User, sessionID uuid.UUID) (string, time.Time, error) {
+	return auth.Issue(auth.Claims{
+		UserID:                 user.ID,
+		IsAdmin:                user.IsAdmin,
+		Permissions:            user.Permissions(),
+		SessionID:              sessionID.String(),
+		TwoFactorSetupRequired: twoFactorSetupRequired(db, user),
+	}, auth.TokenTypeAccess, accessTokenTTL())
+}
+
+// newRefreshToken grava um novo refresh token da sessão e devolve o valor em claro,
+// que só é mostrado ao cliente.
+func newRefreshToken(tx *gorm.DB, c *gin.Context, userID, sessionID uuid.UUID) (*models.RefreshToken, string, error) {
+	raw := utils.GenerateRandomToken() + utils.GenerateRandomToken()
+	record := models.RefreshToken{
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, "", err
+	}
+	return &record, raw, nil
+}
+
+// startSession abre uma nova sessão para o usuário e responde com o par de tokens.
+func startSession(c *gin.Context, db *gorm.DB, user models.User) {
+	// Aproveita o login para limpar os refresh tokens vencidos do usuário
+	db.Where("user_id = ? AND expires_at < ?", user.ID, time.Now()).Delete(&models.RefreshToken{})
+
+	sessionID := uuid.New()
+	_, refreshToken, err := newRefreshToken(db, c, user.ID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criar sessão"})
+		return
+	}
+	token, expiration, err := generateAccessToken(db, user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_at":    expiration.UnixMilli(),
+		"user": gin.H{
+			"id":             user.ID,
+			"name":           user.Name,
+			"roles":          user.Roles,
+			"email":          user.Email,
+			"is_admin":       user.IsAdmin,
+			"permissions":    user.Permissions(),
+			"photo_url":      user.PhotoURL,
+			"email_verified": user.EmailVerifiedAt != nil,
+			"two_factor":     user.TOTPEnabledAt != nil,
+		},
+		"two_factor_setup_required": twoFactorSetupRequired(db, user),
+	})
+}
+
+// revokeSession revoga os refresh tokens de uma sessão e bloqueia no cache os
+// access tokens já emitidos para ela.
+func revokeSession(db *gorm.DB, cache utils.Cache, sessionID uuid.UUID) error {
+	if err := db.Model(&models.RefreshToken{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	if err := cache.Set(utils.Ctx, utils.SessionRevokedKey(sessionID.String()), "1", accessTokenTTL()); err != nil {
+		log.Printf("Erro ao marcar sessão %s como revogada no cache: %v", sessionID, err)
+	}
+	return nil
+}
+
+// revokeUserSessions encerra todas as sessões do usuário.
+func revokeUserSessions(db *gorm.DB, cache utils.Cache, userID uuid.UUID) error {
+	now := time.Now()
+	if err := db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	key := utils.UserRevokedBeforeKey(userID.String())
+	if err := cache.Set(utils.Ctx, key, strconv.FormatInt(now.Unix(), 10), accessTokenTTL()); err != nil {
+		log.Printf("Erro ao marcar sessões do usuário %s como revogadas no cache: %v", userID, err)
+	}
+	return nil
+}
+
+// revokeOtherSessions encerra as sessões do usuário, menos a atual.
+func revokeOtherSessions(db *gorm.DB, cache utils.Cache, userID, currentSessionID uuid.UUID) error {
+	var sessionIDs []uuid.UUID
+	if err := db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND session_id <> ? AND revoked_at IS NULL", userID, currentSessionID).
+		Distinct().Pluck("session_id", &sessionIDs).Error; err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		if err := revokeSession(db, cache, sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefreshToken troca um refresh token válido por um novo par de tokens. O token
+// usado é revogado; apresentar de novo um token já trocado indica vazamento, e
+// a sessão inteira é encerrada.
+func RefreshToken(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	var current models.RefreshToken
+	if err := db.Where("token_hash = ?", utils.HashToken(input.RefreshToken)).First(&current).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Sessão inválida, faça login novamente"})
+		return
+	}
+
+	if current.RevokedAt != nil {
+		if current.ReplacedBy != nil {
+			log.Printf("Reuso de refresh token detectado na sessão %s do usuário %s", current.SessionID, current.UserID)
+			if err := revokeSession(db, cache, current.SessionID); err != nil {
+				log.Printf("Erro ao revogar sessão %s: %v", current.SessionID, err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Sessão encerrada, faça login novamente"})
+		return
+	}
+	if time.Now().After(current.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Sessão expirada"})
+		return
+	}
+
+	// Contas desativadas não são encontradas aqui (soft delete) e não renovam a sessão
+	var user models.User
+	if err := db.Preload("SystemRoles").First(&user, "id = ?", current.UserID).Error; err != nil || user.Status != models.UserStatusApproved {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+
+	var refreshToken string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		next, raw, err := newRefreshToken(tx, c, user.ID, current.SessionID)
+		if err != nil {
+			return err
+		}
+		// A condição em revoked_at impede que duas renovações simultâneas usem o mesmo token
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidRefreshToken
+		}
+		refreshToken = raw
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Sessão encerrada, faça login novamente"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao renovar sessão"})
+		return
+	}
+
+	token, expiration, err := generateAccessToken(db, user, current.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_at":    expiration.UnixMilli(),
+	})
+}
+
+// Logout encerra a sessão do token usado na requisição.
+func Logout(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	sessionIDVal, exists := c.Get("session_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return
+	}
+
+	if err := revokeSession(db, cache, sessionIDVal.(uuid.UUID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao encerrar sessão"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sessão encerrada com sucesso"})
+}
+
+// ListUserSessions lista as sessões ativas de um voluntário (uma linha por sessão).
+func ListUserSessions(c *gin.Context, db *gorm.DB) {
+	var tokens []models.RefreshToken
+	if err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", c.Param("id"), time.Now()).
+		Order("created_at DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar sessões"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeUserSessions encerra todas as sessões de um voluntário (ex.: celular perdido).
+func RevokeUserSessions(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+
+	if err := revokeUserSessions(db, cache, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao encerrar sessões"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sessões encerradas com sucesso"})
+}
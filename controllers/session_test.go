@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/middlewares"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+type sessionTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func refresh(t *testing.T, db *gorm.DB, cache utils.Cache, refreshToken string) (int, sessionTokens) {
+	t.Helper()
+	payload, _ := json.Marshal(gin.H{"refresh_token": refreshToken})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(payload))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	RefreshToken(c, db, cache)
+	var tokens sessionTokens
+	_ = json.Unmarshal(w.Body.Bytes(), &tokens)
+	return w.Code, tokens
+}
+
+// authorized indica se o access token passa pelo AuthMiddleware.
+func authorized(db *gorm.DB, cache utils.Cache, token string) bool {
+	r := gin.New()
+	r.GET("/me", middlewares.AuthMiddleware(db, cache), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	r.ServeHTTP(w, req)
+	return w.Code == http.StatusNoContent
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	db := testDB(t)
+	cache := utils.NewMemoryCache()
+	user := createTestUser(t, db)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	startSession(c, db, user)
+	if w.Code != http.StatusOK {
+		t.Fatalf("startSession status = %d", w.Code)
+	}
+	var first sessionTokens
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil {
+		t.Fatal(err)
+	}
+
+	status, second := refresh(t, db, cache, first.RefreshToken)
+	if status != http.StatusOK || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("renovação legítima: status %d", status)
+	}
+	if !authorized(db, cache, second.Token) {
+		t.Fatal("access token renovado recusado")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		// Quem apresenta o token já trocado (o atacante ou o cliente legítimo) derruba a sessão
+		{"token já trocado", first.RefreshToken},
+		// Depois disso nem o token mais recente da sessão vale
+		{"token atual da sessão revogada", second.RefreshToken},
+		{"token inexistente", "nao-existe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _ := refresh(t, db, cache, tt.token); status != http.StatusUnauthorized {
+				t.Errorf("status = %d, esperado 401", status)
+			}
+		})
+	}
+
+	var active int64
+	db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+	if active != 0 {
+		t.Errorf("%d refresh tokens ativos depois do reuso, esperado 0", active)
+	}
+	for _, token := range []string{first.Token, second.Token} {
+		if authorized(db, cache, token) {
+			t.Error("access token da sessão revogada ainda aceito")
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"gorm.io/gorm"
+)
+
+// ListSettings lista todas as configurações conhecidas com o valor atual.
+func ListSettings(c *gin.Context, db *gorm.DB) {
+	settings := make(map[string]string, len(models.DefaultSettings))
+	for key := range models.DefaultSettings {
+		value, err := models.GetSetting(db, key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar configurações"})
+			return
+		}
+		settings[key] = value
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings altera uma ou mais configurações ({"chave": "valor"}).
+func UpdateSettings(c *gin.Context, db *gorm.DB) {
+	var input map[string]string
+	if err := c.ShouldBindJSON(&input); err != nil || len(input) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	for key, value := range input {
+		if _, ok := models.DefaultSettings[key]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Configuração desconhecida: " + key})
+			return
+		}
+		if value != "true" && value != "false" {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Valor inválido para " + key + " (use true ou false)"})
+			return
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for key, value := range input {
+			if err := tx.Save(&models.Setting{Key: key, Value: value}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar configurações"})
+		return
+	}
+
+	ListSettings(c, db)
+}
@@ -0,0 +1,466 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/auth"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	twoFactorIssuer       = "CheckinFP"
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+	// Tentativas erradas aceitas por challenge token; depois é preciso refazer o login
+	maxChallengeAttempts = 5
+)
+
+const twoFactorFailedMessage = "*Código de verificação inválido, irmão(ã)"
+
+var errInvalidTwoFactorCode = errors.New("código de verificação inválido ou já utilizado")
+
+// twoFactorSetupRequired indica se o admin ainda precisa ativar a verificação em
+// duas etapas exigida pela configuração require_admin_2fa.
+func twoFactorSetupRequired(db *gorm.DB, user models.User) bool {
+	if !user.IsAdmin || user.TOTPEnabledAt != nil {
+		return false
+	}
+	required, err := models.GetBoolSetting(db, models.SettingRequireAdminTwoFactor)
+	if err != nil {
+		log.Printf("Erro ao consultar configuração %s: %v", models.SettingRequireAdminTwoFactor, err)
+		return false
+	}
+	return required
+}
+
+// respondTwoFactorChallenge responde ao primeiro passo do login de quem tem
+// verificação em duas etapas: em vez da sessão, um token curto que só serve para
+// POST /login/2fa.
+func respondTwoFactorChallenge(c *gin.Context, user models.User) {
+	token, expiration, err := auth.Issue(auth.Claims{UserID: user.ID}, auth.TokenTypeTwoFactor, twoFactorChallengeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"expires_at":          expiration.UnixMilli(),
+	})
+}
+
+// twoFactorChallengeKey guarda no cache o estado de um challenge token (pelo jti):
+// "used" depois do login concluído e "failures" com as tentativas erradas.
+func twoFactorChallengeKey(kind, jti string) string {
+	return fmt.Sprintf("checkinfp:2fa_challenge:%s:%s", kind, jti)
+}
+
+// challengeExhausted indica se o challenge token já foi usado ou esgotou as tentativas.
+func challengeExhausted(cache utils.Cache, jti string) (bool, error) {
+	used, err := cache.Exists(utils.Ctx, twoFactorChallengeKey("used", jti))
+	if err != nil || used {
+		return used, err
+	}
+	val, err := cache.Get(utils.Ctx, twoFactorChallengeKey("failures", jti))
+	if errors.Is(err, utils.ErrCacheMiss) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	failures, _ := strconv.Atoi(val)
+	return failures >= maxChallengeAttempts, nil
+}
+
+// checkTOTP confere o código do autenticador e registra o passo usado, para que o
+// mesmo código não valha de novo.
+func checkTOTP(db *gorm.DB, user models.User, code string) error {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return errInvalidTwoFactorCode
+	}
+	result := db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// useRecoveryCode consome um código de recuperação ainda não usado.
+func useRecoveryCode(db *gorm.DB, userID uuid.UUID, code string) error {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// checkSecondFactor aceita o código do autenticador ou, na falta dele, um código
+// de recuperação.
+func checkSecondFactor(db *gorm.DB, user models.User, code, recoveryCode string) error {
+	if code != "" {
+		return checkTOTP(db, user, code)
+	}
+	if recoveryCode != "" {
+		return useRecoveryCode(db, user.ID, recoveryCode)
+	}
+	return errInvalidTwoFactorCode
+}
+
+// replaceRecoveryCodes apaga os códigos de recuperação do usuário e gera novos,
+// devolvidos em claro uma única vez.
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code)),
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// currentUserWithPassword carrega o usuário logado e confere a senha atual, exigida
+// para mexer na verificação em duas etapas. Responde e retorna false em caso de erro.
+func currentUserWithPassword(c *gin.Context, db *gorm.DB, password string) (models.User, bool) {
+	var user models.User
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return user, false
+	}
+	if err := db.First(&user, "id = ?", userIDVal.(uuid.UUID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return user, false
+	}
+	if password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "*Informe sua senha atual, irmão(ã)"})
+		return user, false
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "*Senha atual incorreta, irmão(ã)"})
+		return user, false
+	}
+	return user, true
+}
+
+// LoginTwoFactor conclui o login de quem tem verificação em duas etapas, com o
+// challenge_token do primeiro passo e o código do autenticador (code) ou um
+// código de recuperação (recovery_code).
+func LoginTwoFactor(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	claims, err := auth.Parse(input.ChallengeToken, auth.TokenTypeTwoFactor)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Verificação expirada, faça login novamente"})
+		return
+	}
+	// Sem o cache não dá para saber se o challenge já foi usado: recusa
+	exhausted, err := challengeExhausted(cache, claims.ID)
+	if err != nil {
+		log.Printf("Erro ao consultar challenge de verificação em duas etapas: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Erro ao validar código"})
+		return
+	}
+	if exhausted {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Verificação expirada, faça login novamente"})
+		return
+	}
+
+	var user models.User
+	if err := db.Preload("SystemRoles").First(&user, "id = ?", claims.UserID).Error; err != nil || user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Verificação expirada, faça login novamente"})
+		return
+	}
+
+	// Os códigos têm só 6 dígitos: as tentativas erradas contam no mesmo limite do login
+	limits := loadLoginLimits()
+	email := normalizeLoginEmail(user.Email)
+	if blocked, retryAfter := loginBlocked(cache, limits, email, c.ClientIP()); blocked {
+		respondLoginBlocked(c, retryAfter)
+		return
+	}
+	if err := checkSecondFactor(db, user, input.Code, input.RecoveryCode); err != nil {
+		if !errors.Is(err, errInvalidTwoFactorCode) {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao validar código"})
+			return
+		}
+		if _, err := cache.Incr(utils.Ctx, twoFactorChallengeKey("failures", claims.ID), twoFactorChallengeTTL); err != nil {
+			log.Printf("Erro ao registrar tentativa no challenge de verificação em duas etapas: %v", err)
+		}
+		respondLoginFailure(c, cache, limits, email, twoFactorFailedMessage)
+		return
+	}
+	// O challenge vale para um único login
+	first, err := cache.SetNX(utils.Ctx, twoFactorChallengeKey("used", claims.ID), "1", twoFactorChallengeTTL)
+	if err != nil {
+		log.Printf("Erro ao marcar challenge de verificação em duas etapas como usado: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Erro ao validar código"})
+		return
+	}
+	if !first {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Verificação expirada, faça login novamente"})
+		return
+	}
+	_ = cache.Del(utils.Ctx, loginAccountKey(email))
+
+	startSession(c, db, user)
+}
+
+// SetupTwoFactor inicia a configuração da verificação em duas etapas: gera o
+// segredo e devolve o link otpauth:// e o QR Code para o aplicativo autenticador.
+// A verificação só passa a valer depois de confirmada em EnableTwoFactor.
+func SetupTwoFactor(c *gin.Context, db *gorm.DB) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	user, ok := currentUserWithPassword(c, db, input.CurrentPassword)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "A verificação em duas etapas já está ativada"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar segredo"})
+		return
+	}
+	if err := db.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao salvar segredo"})
+		return
+	}
+
+	uri := utils.TOTPURI(twoFactorIssuer, user.Email, secret)
+	qrCode, err := utils.TOTPQRCode(uri)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar QR Code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"qr_code":     qrCode,
+	})
+}
+
+// EnableTwoFactor confirma a configuração com um código do autenticador, ativa a
+// verificação em duas etapas e devolve os códigos de recuperação. As outras
+// sessões são encerradas, já que foram abertas sem o segundo fator.
+func EnableTwoFactor(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return
+	}
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", userIDVal.(uuid.UUID)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "A verificação em duas etapas já está ativada"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Inicie a configuração da verificação em duas etapas primeiro"})
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkTOTP(tx, user, input.Code); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": twoFactorFailedMessage})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao ativar verificação em duas etapas"})
+		return
+	}
+	endOtherSessions(c, db, cache, user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Verificação em duas etapas ativada. Guarde os códigos de recuperação em local seguro",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor desativa a verificação em duas etapas; exige a senha atual e um
+// código do autenticador ou de recuperação. Admins não podem desativar enquanto
+// require_admin_2fa estiver ligado. As outras sessões são encerradas.
+func DisableTwoFactor(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Code            string `json:"code"`
+		RecoveryCode    string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	user, ok := currentUserWithPassword(c, db, input.CurrentPassword)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "A verificação em duas etapas não está ativada"})
+		return
+	}
+	if required, _ := models.GetBoolSetting(db, models.SettingRequireAdminTwoFactor); required && user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"message": "A verificação em duas etapas é obrigatória para administradores"})
+		return
+	}
+
+	if err := checkSecondFactor(db, user, input.Code, input.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": twoFactorFailedMessage})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao validar código"})
+		return
+	}
+
+	if err := clearTwoFactor(db, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao desativar verificação em duas etapas"})
+		return
+	}
+	endOtherSessions(c, db, cache, user.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Verificação em duas etapas desativada"})
+}
+
+// endOtherSessions encerra as sessões do usuário, menos a da requisição.
+func endOtherSessions(c *gin.Context, db *gorm.DB, cache utils.Cache, userID uuid.UUID) {
+	sessionID, _ := c.Get("session_id")
+	current, _ := sessionID.(uuid.UUID)
+	if err := revokeOtherSessions(db, cache, userID, current); err != nil {
+		log.Printf("Erro ao encerrar outras sessões do usuário %s: %v", userID, err)
+	}
+}
+
+// RegenerateRecoveryCodes troca os códigos de recuperação por novos (os antigos
+// deixam de valer).
+func RegenerateRecoveryCodes(c *gin.Context, db *gorm.DB) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+	user, ok := currentUserWithPassword(c, db, input.CurrentPassword)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "A verificação em duas etapas não está ativada"})
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao gerar códigos de recuperação"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetUserTwoFactor desativa a verificação em duas etapas de um voluntário que
+// perdeu o celular e os códigos de recuperação. As sessões dele são encerradas.
+func ResetUserTwoFactor(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+
+	if err := clearTwoFactor(db, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao desativar verificação em duas etapas"})
+		return
+	}
+	if err := revokeUserSessions(db, cache, user.ID); err != nil {
+		log.Printf("Erro ao encerrar sessões do usuário %s: %v", user.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verificação em duas etapas desativada"})
+}
+
+func clearTwoFactor(db *gorm.DB, userID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/auth"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+)
+
+func TestTwoFactorChallengeToken(t *testing.T) {
+	user := models.User{ID: uuid.New()}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	respondTwoFactorChallenge(c, user)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, esperado 200", w.Code)
+	}
+	var body struct {
+		ChallengeToken string `json:"challenge_token"`
+		ExpiresAt      int64  `json:"expires_at"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := auth.Parse(body.ChallengeToken, auth.TokenTypeTwoFactor)
+	if err != nil {
+		t.Fatalf("challenge token rejeitado: %v", err)
+	}
+	if claims.UserID != user.ID {
+		t.Errorf("UserID = %s, esperado %s", claims.UserID, user.ID)
+	}
+	if remaining := time.Until(time.UnixMilli(body.ExpiresAt)); remaining > twoFactorChallengeTTL || remaining < twoFactorChallengeTTL-time.Minute {
+		t.Errorf("challenge expira em %s, esperado %s", remaining, twoFactorChallengeTTL)
+	}
+	if _, err := auth.Parse(body.ChallengeToken, auth.TokenTypeAccess); !errors.Is(err, auth.ErrWrongTokenType) {
+		t.Errorf("challenge aceito como access token: %v", err)
+	}
+}
+
+func TestLoginTwoFactorRejectsInvalidChallenge(t *testing.T) {
+	userID := uuid.New()
+	expired, _, err := auth.Issue(auth.Claims{UserID: userID}, auth.TokenTypeTwoFactor, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Parse(expired, auth.TokenTypeTwoFactor); !errors.Is(err, auth.ErrExpiredToken) {
+		t.Fatalf("Parse do challenge vencido = %v, esperado ErrExpiredToken", err)
+	}
+	access, _, err := auth.Issue(auth.Claims{UserID: userID}, auth.TokenTypeAccess, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"challenge vencido", expired},
+		{"access token no lugar do challenge", access},
+		{"token malformado", "abc.def.ghi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, _ := json.Marshal(gin.H{"challenge_token": tt.token, "code": "123456"})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewReader(payload))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			// O token é recusado antes de qualquer consulta ao banco
+			LoginTwoFactor(c, nil, utils.NewMemoryCache())
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, esperado 401", w.Code)
+			}
+		})
+	}
+}
+
+func TestUseRecoveryCodeIsSingleUse(t *testing.T) {
+	db := testDB(t)
+	user := createTestUser(t, db)
+	other := createTestUser(t, db)
+
+	codes, err := replaceRecoveryCodes(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d códigos gerados, esperado %d", len(codes), recoveryCodeCount)
+	}
+
+	if err := useRecoveryCode(db, other.ID, codes[0]); !errors.Is(err, errInvalidTwoFactorCode) {
+		t.Errorf("código de outro usuário = %v, esperado errInvalidTwoFactorCode", err)
+	}
+	// Digitado em caixa alta e sem hífen, como costuma vir do celular
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	if err := useRecoveryCode(db, user.ID, typed); err != nil {
+		t.Fatalf("primeiro uso recusado: %v", err)
+	}
+	if err := useRecoveryCode(db, user.ID, codes[0]); !errors.Is(err, errInvalidTwoFactorCode) {
+		t.Errorf("segundo uso = %v, esperado errInvalidTwoFactorCode", err)
+	}
+	if err := useRecoveryCode(db, user.ID, codes[1]); err != nil {
+		t.Errorf("outro código do usuário recusado: %v", err)
+	}
+
+	// Gerar novos códigos invalida os antigos
+	if _, err := replaceRecoveryCodes(db, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := useRecoveryCode(db, user.ID, codes[2]); !errors.Is(err, errInvalidTwoFactorCode) {
+		t.Errorf("código antigo depois de regenerar = %v, esperado errInvalidTwoFactorCode", err)
+	}
+}
+
+func TestLoginTwoFactorRejectsSpentChallenge(t *testing.T) {
+	tests := []struct {
+		name  string
+		spend func(cache utils.Cache, jti string)
+	}{
+		{"challenge já usado", func(cache utils.Cache, jti string) {
+			cache.Set(utils.Ctx, twoFactorChallengeKey("used", jti), "1", time.Minute)
+		}},
+		{"tentativas esgotadas", func(cache utils.Cache, jti string) {
+			for i := 0; i < maxChallengeAttempts; i++ {
+				cache.Incr(utils.Ctx, twoFactorChallengeKey("failures", jti), time.Minute)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := auth.Issue(auth.Claims{UserID: uuid.New()}, auth.TokenTypeTwoFactor, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := auth.Parse(token, auth.TokenTypeTwoFactor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache := utils.NewMemoryCache()
+			if exhausted, _ := challengeExhausted(cache, claims.ID); exhausted {
+				t.Fatal("challenge novo considerado esgotado")
+			}
+			tt.spend(cache, claims.ID)
+
+			payload, _ := json.Marshal(gin.H{"challenge_token": token, "code": "123456"})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewReader(payload))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			// Recusado antes de consultar o banco
+			LoginTwoFactor(c, nil, cache)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, esperado 401", w.Code)
+			}
+		})
+	}
+}
@@ -7,21 +7,76 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/middlewares"
 	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
 	"gorm.io/gorm"
 )
 
+// volunteerInput são os únicos campos aceitos ao cadastrar um voluntário; admin,
+// situação e papéis de sistema são definidos pelo servidor.
+type volunteerInput struct {
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+// volunteerResponse são os dados do voluntário devolvidos pela API, sem senha
+// nem segredos.
+func volunteerResponse(user models.User) gin.H {
+	return gin.H{
+		"id":             user.ID,
+		"name":           user.Name,
+		"email":          user.Email,
+		"roles":          user.Roles,
+		"is_admin":       user.IsAdmin,
+		"photo_url":      user.PhotoURL,
+		"status":         user.Status,
+		"email_verified": user.EmailVerifiedAt != nil,
+		"created_at":     user.CreatedAt,
+	}
+}
+
 func CreateVolunteer(c *gin.Context, db *gorm.DB) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var input volunteerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
 		return
 	}
+	roles, err := normalizeRoles(db, input.Roles, nil)
+	if err != nil {
+		respondRolesError(c, err)
+		return
+	}
+	if err := utils.ValidatePassword(input.Password, input.Name, input.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao criptografar senha"})
+		return
+	}
+
+	// Cadastrado por quem gerencia voluntários, já entra aprovado (mas nunca como admin)
+	user := models.User{
+		Name:     input.Name,
+		Email:    input.Email,
+		Password: hashedPassword,
+		Roles:    roles,
+		IsAdmin:  false,
+		Status:   models.UserStatusApproved,
+	}
 	if err := db.Create(&user).Error; err != nil {
+		if utils.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"message": "*E-mail já cadastrado, irmão(ã)"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Não foi possível cadastrar o usuário"})
 		return
 	}
-	c.JSON(http.StatusCreated, user)
+	c.JSON(http.StatusCreated, volunteerResponse(user))
 }
 
 func ListVolunteers(c *gin.Context, db *gorm.DB) {
@@ -32,12 +87,19 @@ func ListVolunteers(c *gin.Context, db *gorm.DB) {
 
 	query := db.Model(&models.User{})
 
+	// Cadastros pendentes ou recusados só aparecem para quem gerencia voluntários
+	status := models.UserStatusApproved
+	if middlewares.HasPermission(c, models.PermissionUsersManage) && c.Query("status") != "" {
+		status = c.Query("status")
+	}
+	query = query.Where("status = ?", status)
+
 	if name != "" {
 		query = query.Where("name LIKE ?", "%"+name+"%")
 	}
 
 	if roles != "" {
-		query = query.Where("roles @> ?", fmt.Sprintf(`["%s"]`, roles))
+		query = query.Where("roles::jsonb @> ?", fmt.Sprintf(`["%s"]`, utils.Slugify(roles)))
 	}
 
 	if err := query.Find(&users).Error; err != nil {
@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+// findManagedUser carrega o voluntário da rota (inclusive desativado, com unscoped)
+// e recusa operações do admin sobre a própria conta. Responde e retorna false em
+// caso de erro.
+func findManagedUser(c *gin.Context, db *gorm.DB, unscoped bool) (models.User, bool) {
+	var user models.User
+	query := db
+	if unscoped {
+		query = db.Unscoped()
+	}
+	if err := query.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return user, false
+	}
+	if actorID, _ := c.Get("user_id"); actorID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Você não pode alterar a sua própria conta por aqui"})
+		return user, false
+	}
+	return user, true
+}
+
+// isLastAdmin indica se o usuário é o único admin ativo, que não pode perder o acesso.
+func isLastAdmin(db *gorm.DB, user models.User) (bool, error) {
+	if !user.IsAdmin {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&models.User{}).Where("is_admin = ? AND id <> ?", true, user.ID).Count(&count).Error
+	return count == 0, err
+}
+
+// respondLastAdmin responde quando a operação deixaria o sistema sem admins.
+func respondLastAdmin(c *gin.Context, db *gorm.DB, user models.User) bool {
+	last, err := isLastAdmin(db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar administradores"})
+		return true
+	}
+	if last {
+		c.JSON(http.StatusConflict, gin.H{"message": "O sistema precisa de pelo menos um administrador"})
+		return true
+	}
+	return false
+}
+
+// SetUserAdmin concede ou retira o acesso de administrador. Ao retirar, as sessões
+// do voluntário são encerradas para que o token de admin pare de valer na hora.
+func SetUserAdmin(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	var input struct {
+		IsAdmin *bool `json:"is_admin"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || input.IsAdmin == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dados inválidos"})
+		return
+	}
+
+	user, ok := findManagedUser(c, db, false)
+	if !ok {
+		return
+	}
+	if *input.IsAdmin && user.Status != models.UserStatusApproved {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Só voluntários aprovados podem ser administradores"})
+		return
+	}
+	if !*input.IsAdmin && respondLastAdmin(c, db, user) {
+		return
+	}
+
+	demoted := user.IsAdmin && !*input.IsAdmin
+	if err := db.Model(&user).Update("is_admin", *input.IsAdmin).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao atualizar administrador"})
+		return
+	}
+	if demoted {
+		if err := revokeUserSessions(db, cache, user.ID); err != nil {
+			log.Printf("Erro ao encerrar sessões do usuário %s: %v", user.ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"id": user.ID, "is_admin": *input.IsAdmin})
+}
+
+// DeactivateUser desativa um voluntário que saiu do ministério (soft delete): ele
+// some das listagens, não consegue mais fazer login e as sessões são encerradas.
+// O histórico de check-ins é mantido.
+func DeactivateUser(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	user, ok := findManagedUser(c, db, false)
+	if !ok {
+		return
+	}
+	if respondLastAdmin(c, db, user) {
+		return
+	}
+
+	if err := db.Delete(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao desativar voluntário"})
+		return
+	}
+	if err := revokeUserSessions(db, cache, user.ID); err != nil {
+		log.Printf("Erro ao encerrar sessões do usuário %s: %v", user.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Voluntário desativado com sucesso"})
+}
+
+// ReactivateUser reativa um voluntário desativado.
+func ReactivateUser(c *gin.Context, db *gorm.DB) {
+	user, ok := findManagedUser(c, db, true)
+	if !ok {
+		return
+	}
+	if !user.DeletedAt.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "O voluntário não está desativado"})
+		return
+	}
+
+	if err := db.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao reativar voluntário"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Voluntário reativado com sucesso"})
+}
+
+// DeleteUser apaga definitivamente um voluntário (ativo ou desativado), junto com
+// os check-ins e o histórico de auditoria deles, sessões, tokens e papéis de sistema.
+func DeleteUser(c *gin.Context, db *gorm.DB, cache utils.Cache) {
+	user, ok := findManagedUser(c, db, true)
+	if !ok {
+		return
+	}
+	if !user.DeletedAt.Valid && respondLastAdmin(c, db, user) {
+		return
+	}
+
+	var deletedCheckins int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.CheckinAudit{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("user_id = ?", user.ID).Delete(&models.VolunteerCheckin{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deletedCheckins = result.RowsAffected
+
+		for _, model := range []interface{}{
+			&models.RefreshToken{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}, &models.RecoveryCode{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("DELETE FROM user_system_roles WHERE user_id = ?", user.ID).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao apagar voluntário"})
+		return
+	}
+
+	// Os refresh tokens já foram apagados; isso só bloqueia os access tokens em uso
+	if err := revokeUserSessions(db, cache, user.ID); err != nil {
+		log.Printf("Erro ao encerrar sessões do usuário %s: %v", user.ID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Voluntário apagado com sucesso",
+		"deleted_checkins": deletedCheckins,
+	})
+}
+
+// ListDeactivatedUsers lista os voluntários desativados.
+func ListDeactivatedUsers(c *gin.Context, db *gorm.DB) {
+	var users []models.User
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao buscar usuários"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		entry := volunteerResponse(user)
+		entry["deleted_at"] = user.DeletedAt.Time
+		response = append(response, entry)
+	}
+	c.JSON(http.StatusOK, response)
+}
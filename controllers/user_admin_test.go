@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/middlewares"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+// adminStatus faz GET /admin com o access token e devolve o status da resposta.
+func adminStatus(db *gorm.DB, cache utils.Cache, token string) int {
+	r := gin.New()
+	r.GET("/admin", middlewares.AuthMiddleware(db, cache), middlewares.RequireAdmin(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+// As marcas de revogação ficam no cache; um cache vazio simula outra instância
+// (ou um Redis que perdeu as chaves), e a conta ainda assim é recusada.
+func TestAuthMiddlewareChecksAccountWithoutCacheMarks(t *testing.T) {
+	db := testDB(t)
+	user := createTestUser(t, db)
+	if err := db.Model(&user).Update("is_admin", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	user.IsAdmin = true
+
+	token, _, err := generateAccessToken(db, user, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := adminStatus(db, utils.NewMemoryCache(), token); status != http.StatusNoContent {
+		t.Fatalf("admin ativo: status %d, esperado 204", status)
+	}
+
+	if err := db.Model(&user).Update("is_admin", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if status := adminStatus(db, utils.NewMemoryCache(), token); status != http.StatusForbidden {
+		t.Errorf("admin rebaixado: status %d, esperado 403", status)
+	}
+
+	if err := db.Delete(&models.User{}, "id = ?", user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if status := adminStatus(db, utils.NewMemoryCache(), token); status != http.StatusUnauthorized {
+		t.Errorf("voluntário desativado: status %d, esperado 401", status)
+	}
+}
+
+// adminAction chama o handler como o admin actor, com :id da rota.
+func adminAction(actor, target uuid.UUID, handler func(c *gin.Context)) int {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/admin", nil)
+	c.Set("user_id", actor)
+	c.Set("is_admin", true)
+	c.Params = gin.Params{{Key: "id", Value: target.String()}}
+	handler(c)
+	return w.Code
+}
+
+func TestIsLastAdminIgnoresVolunteers(t *testing.T) {
+	// Voluntário comum nunca é o último admin; não chega a consultar o banco
+	if last, err := isLastAdmin(nil, models.User{}); last || err != nil {
+		t.Errorf("isLastAdmin = (%v, %v), esperado (false, nil)", last, err)
+	}
+}
+
+func TestDeactivateUser(t *testing.T) {
+	// Tudo numa transação desfeita no fim: os admins que já existirem no banco de
+	// testes são rebaixados para que o cenário de "último admin" seja controlado.
+	tx := testDB(t).Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	if err := tx.Model(&models.User{}).Where("is_admin = ?", true).Update("is_admin", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	newUser := func(admin bool) models.User {
+		user := models.User{
+			Name:     "Voluntário de Teste",
+			Email:    "teste-" + uuid.NewString() + "@example.com",
+			Password: "hash",
+			Status:   models.UserStatusApproved,
+			IsAdmin:  admin,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	cache := utils.NewMemoryCache()
+	admin := newUser(true)
+	volunteer := newUser(false)
+
+	if last, err := isLastAdmin(tx, admin); !last || err != nil {
+		t.Fatalf("isLastAdmin do único admin = (%v, %v), esperado (true, nil)", last, err)
+	}
+
+	deactivate := func(c *gin.Context) { DeactivateUser(c, tx, cache) }
+	reactivate := func(c *gin.Context) { ReactivateUser(c, tx) }
+
+	if status := adminAction(admin.ID, admin.ID, deactivate); status != http.StatusBadRequest {
+		t.Errorf("desativar a própria conta: status %d, esperado 400", status)
+	}
+	if status := adminAction(volunteer.ID, admin.ID, deactivate); status != http.StatusConflict {
+		t.Errorf("desativar o último admin: status %d, esperado 409", status)
+	}
+	if status := adminAction(admin.ID, uuid.New(), deactivate); status != http.StatusNotFound {
+		t.Errorf("desativar usuário inexistente: status %d, esperado 404", status)
+	}
+
+	refresh := models.RefreshToken{UserID: volunteer.ID, SessionID: uuid.New(), TokenHash: utils.GenerateRandomToken(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := tx.Create(&refresh).Error; err != nil {
+		t.Fatal(err)
+	}
+	if status := adminAction(admin.ID, volunteer.ID, deactivate); status != http.StatusOK {
+		t.Fatalf("desativar voluntário: status %d, esperado 200", status)
+	}
+	if err := tx.First(&models.User{}, "id = ?", volunteer.ID).Error; err == nil {
+		t.Error("voluntário desativado ainda aparece nas consultas normais")
+	}
+	if err := tx.First(&refresh, "id = ?", refresh.ID).Error; err != nil || refresh.RevokedAt == nil {
+		t.Errorf("refresh token do voluntário desativado não foi revogado (%v)", err)
+	}
+	if revoked, _ := cache.Exists(utils.Ctx, utils.UserRevokedBeforeKey(volunteer.ID.String())); !revoked {
+		t.Error("access tokens do voluntário desativado não foram bloqueados no cache")
+	}
+	if status := adminAction(admin.ID, volunteer.ID, deactivate); status != http.StatusNotFound {
+		t.Errorf("desativar de novo: status %d, esperado 404", status)
+	}
+
+	if status := adminAction(admin.ID, volunteer.ID, reactivate); status != http.StatusOK {
+		t.Fatalf("reativar: status %d, esperado 200", status)
+	}
+	if err := tx.First(&models.User{}, "id = ?", volunteer.ID).Error; err != nil {
+		t.Errorf("voluntário reativado não aparece nas consultas: %v", err)
+	}
+	if status := adminAction(admin.ID, volunteer.ID, reactivate); status != http.StatusBadRequest {
+		t.Errorf("reativar quem não está desativado: status %d, esperado 400", status)
+	}
+
+	// Com um segundo admin, o primeiro pode ser desativado
+	second := newUser(true)
+	if last, err := isLastAdmin(tx, admin); last || err != nil {
+		t.Errorf("isLastAdmin com dois admins = (%v, %v), esperado (false, nil)", last, err)
+	}
+	if status := adminAction(second.ID, admin.ID, deactivate); status != http.StatusOK {
+		t.Errorf("desativar admin com outro admin ativo: status %d, esperado 200", status)
+	}
+}
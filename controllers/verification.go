@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
+)
+
+const verificationTokenTTL = 48 * time.Hour
+
+var errVerificationTokenUsed = errors.New("token de confirmação já utilizado")
+
+// sendVerificationEmail gera um novo link de confirmação (invalidando os anteriores)
+// e o envia para o e-mail atual do usuário.
+func sendVerificationEmail(c *gin.Context, db *gorm.DB, mailer utils.Mailer, user models.User) error {
+	token := utils.GenerateRandomToken() + utils.GenerateRandomToken()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailVerificationToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(verificationTokenTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return utils.SendTemplate(c.Request.Context(), mailer, "email_verification", user.Email, gin.H{
+		"Name":           user.Name,
+		"Link":           utils.FrontendURL("/verify-email", url.Values{"token": {token}}),
+		"ExpiresInHours": int(verificationTokenTTL.Hours()),
+	})
+}
+
+// VerifyEmail confirma o e-mail a partir do link enviado no cadastro.
+func VerifyEmail(c *gin.Context, db *gorm.DB) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Token ausente na requisição"})
+		return
+	}
+
+	var record models.EmailVerificationToken
+	if err := db.Where("token_hash = ? AND used_at IS NULL", utils.HashToken(token)).First(&record).Error; err != nil ||
+		time.Now().After(record.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Link de confirmação inválido ou expirado"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&record).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVerificationTokenUsed
+		}
+		return tx.Model(&models.User{}).Where("id = ?", record.UserID).Update("email_verified_at", now).Error
+	})
+	if err != nil {
+		if errors.Is(err, errVerificationTokenUsed) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Link de confirmação inválido ou expirado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao confirmar e-mail"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "E-mail confirmado com sucesso, irmão(ã)!"})
+}
+
+// ResendVerificationEmail reenvia o link de confirmação para o usuário autenticado.
+func ResendVerificationEmail(c *gin.Context, db *gorm.DB, mailer utils.Mailer) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Usuário não autenticado"})
+		return
+	}
+	userID := userIDVal.(uuid.UUID)
+
+	var user models.User
+	if err := db.First(&user, "id = ?", userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Usuário não encontrado"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Seu e-mail já está confirmado"})
+		return
+	}
+
+	if err := sendVerificationEmail(c, db, mailer, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao enviar e-mail"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Enviamos um novo link de confirmação para seu e-mail"})
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/nicolaslucianob/checkinfp/auth"
 	"github.com/nicolaslucianob/checkinfp/models"
 	"github.com/nicolaslucianob/checkinfp/routes"
+	"github.com/nicolaslucianob/checkinfp/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -29,10 +33,42 @@ func main() {
 		}
 	}
 
+	if err := auth.CheckConfig(); err != nil {
+		log.Fatalf("Erro na configuração do JWT: %v", err)
+	}
+	if err := utils.CheckRotatingQRSecret(); err != nil {
+		log.Fatalf("Erro na configuração do QR Code: %v", err)
+	}
+
 	db = initDB()
 	log.Println("✅ Banco conectado com sucesso!")
 
+	cache, err := utils.NewCache()
+	if err != nil {
+		log.Fatalf("Erro ao configurar o cache: %v", err)
+	}
+	if err := pingCache(cache); err != nil {
+		log.Fatalf("Erro ao conectar com o cache: %v", err)
+	}
+	log.Println("✅ Cache conectado com sucesso!")
+	go monitorCache(cache, utils.EnvDuration("CACHE_HEALTH_CHECK_INTERVAL", 0))
+
+	store, err := utils.NewStorage()
+	if err != nil {
+		log.Fatalf("Erro ao configurar o storage: %v", err)
+	}
+
+	mailer, err := utils.NewMailer()
+	if err != nil {
+		log.Fatalf("Erro ao configurar o envio de e-mails: %v", err)
+	}
+
 	r := gin.Default()
+	// Sem proxies confiáveis, o IP do cliente (usado no limite de tentativas de login)
+	// é o da conexão; X-Forwarded-For só é lido quando vem de um proxy listado.
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("TRUSTED_PROXIES inválido: %v", err)
+	}
 	r.Use(cors.New(cors.Config{
 		AllowOriginFunc: func(origin string) bool {
 			frontLocal := "http://localhost:3000"
@@ -47,13 +83,24 @@ func main() {
 		AllowCredentials: true,
 	}))
 
-	routes.RegisterRoutes(r, db)
+	routes.RegisterRoutes(r, db, cache, store, mailer)
 
 	if err := r.Run("0.0.0.0:8080"); err != nil {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }
 
+// trustedProxies lê TRUSTED_PROXIES (IPs ou CIDRs separados por vírgula).
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 func initDB() *gorm.DB {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password='%s' dbname=%s port=%s sslmode=disable TimeZone=America/Sao_Paulo",
@@ -69,8 +116,29 @@ func initDB() *gorm.DB {
 		log.Fatal("Erro ao conectar com o banco de dados:", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.VolunteerCheckin{}); err != nil {
+	if err := models.Migrate(db); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 	return db
 }
+
+func pingCache(cache utils.Cache) error {
+	ctx, cancel := context.WithTimeout(context.Background(), utils.EnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second))
+	defer cancel()
+	return cache.Ping(ctx)
+}
+
+// monitorCache verifica o cache periodicamente e registra falhas no log.
+// Desativado quando o intervalo é zero.
+func monitorCache(cache utils.Cache, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := pingCache(cache); err != nil {
+			log.Printf("⚠️ Cache indisponível: %v", err)
+		}
+	}
+}
@@ -1,20 +1,28 @@
 package middlewares
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/auth"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
+	"gorm.io/gorm"
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET"))
-
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware valida o access token e recusa os de sessões encerradas
+// (logout, revogação pelo admin ou conta desativada), consultando as marcas de
+// revogação no cache. A conta também é conferida no banco a cada requisição:
+// voluntários desativados são recusados e quem perdeu o acesso de admin deixa de
+// tê-lo na hora, mesmo que a marca no cache tenha se perdido.
+func AuthMiddleware(db *gorm.DB, cache utils.Cache) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 
@@ -26,12 +34,9 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-
+		claims, err := auth.Parse(tokenString, auth.TokenTypeAccess)
 		if err != nil {
-			if err == jwt.ErrTokenExpired {
+			if errors.Is(err, auth.ErrExpiredToken) {
 				c.JSON(http.StatusUnauthorized, gin.H{"message": "Sessão expirada"})
 			} else {
 				c.JSON(http.StatusUnauthorized, gin.H{"message": "Token inválido"})
@@ -40,21 +45,93 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userIDStr := claims["user_id"].(string)
-			userID, err := uuid.Parse(userIDStr)
-			if err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"message": "Token inválido: user_id inválido"})
-				c.Abort()
-				return
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Token inválido"})
+			c.Abort()
+			return
+		}
+		if sessionRevoked(cache, claims.SessionID, claims.UserID.String(), claims.IssuedAt.Unix()) {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Sessão encerrada"})
+			c.Abort()
+			return
+		}
+
+		var account struct {
+			IsAdmin bool
+			Status  string
+		}
+		if err := db.Model(&models.User{}).Select("is_admin", "status").
+			Where("id = ?", claims.UserID).Take(&account).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusUnauthorized, gin.H{"message": "Sessão encerrada"})
+			} else {
+				log.Printf("Erro ao consultar a conta %s: %v", claims.UserID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Erro ao validar sessão"})
 			}
+			c.Abort()
+			return
+		}
+		if account.Status != models.UserStatusApproved {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Sessão encerrada"})
+			c.Abort()
+			return
+		}
 
-			isAdmin := claims["is_admin"].(bool)
+		if claims.TwoFactorSetupRequired && !twoFactorSetupRoute(c.FullPath()) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "Ative a verificação em duas etapas para continuar",
+				"code":    "two_factor_setup_required",
+			})
+			c.Abort()
+			return
+		}
 
-			c.Set("user_id", userID)
-			c.Set("is_admin", isAdmin)
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"message": "Token inválido"})
+		c.Set("user_id", claims.UserID)
+		c.Set("is_admin", claims.IsAdmin && account.IsAdmin)
+		c.Set("permissions", claims.Permissions)
+		c.Set("session_id", sessionID)
+
+		c.Next()
+	}
+}
+
+// twoFactorSetupRoute indica as rotas liberadas para quem ainda precisa ativar a
+// verificação em duas etapas.
+func twoFactorSetupRoute(path string) bool {
+	return path == "/me" || path == "/logout" || strings.HasPrefix(path, "/me/2fa")
+}
+
+// sessionRevoked indica se a sessão foi encerrada ou se o token foi emitido antes
+// de uma revogação de todas as sessões do usuário. Falhas no cache não bloqueiam
+// o acesso: o access token expira em poucos minutos de qualquer forma.
+func sessionRevoked(cache utils.Cache, sessionID, userID string, issuedAt int64) bool {
+	revoked, err := cache.Exists(utils.Ctx, utils.SessionRevokedKey(sessionID))
+	if err != nil {
+		log.Printf("Erro ao consultar revogação da sessão %s: %v", sessionID, err)
+	} else if revoked {
+		return true
+	}
+
+	val, err := cache.Get(utils.Ctx, utils.UserRevokedBeforeKey(userID))
+	if err != nil {
+		if !errors.Is(err, utils.ErrCacheMiss) {
+			log.Printf("Erro ao consultar revogação das sessões do usuário %s: %v", userID, err)
+		}
+		return false
+	}
+	// iat e a marca têm precisão de segundos: um token do mesmo segundo da revogação
+	// é aceito, para não derrubar o login feito logo depois de redefinir a senha
+	revokedBefore, err := strconv.ParseInt(val, 10, 64)
+	return err == nil && issuedAt < revokedBefore
+}
+
+// RequireAdmin deve vir depois do AuthMiddleware e bloqueia com 403 quem não é admin.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, _ := c.Get("is_admin")
+		if admin, ok := isAdmin.(bool); !ok || !admin {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Acesso restrito a administradores"})
 			c.Abort()
 			return
 		}
@@ -63,6 +140,49 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// HasPermission indica se o usuário autenticado tem a permissão (admins têm todas).
+func HasPermission(c *gin.Context, permission string) bool {
+	if isAdmin, _ := c.Get("is_admin"); isAdmin == true {
+		return true
+	}
+	permissions, _ := c.Get("permissions")
+	list, _ := permissions.([]string)
+	for _, p := range list {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission deve vir depois do AuthMiddleware e bloqueia com 403 quem não
+// tem a permissão exigida pela rota.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Você não tem permissão para acessar este recurso"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAnyPermission é como RequirePermission, mas basta uma das permissões.
+func RequireAnyPermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, permission := range permissions {
+			if HasPermission(c, permission) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"message": "Você não tem permissão para acessar este recurso"})
+		c.Abort()
+	}
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return cors.New(cors.Config{
 		AllowOrigins:     []string{"https://checkin-fp-jsik.vercel.app", "http://localhost:3000"},
@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nicolaslucianob/checkinfp/utils"
+)
+
+func TestSessionRevoked(t *testing.T) {
+	const sessionID, userID = "sessao", "usuario"
+	revokedAt := time.Now().Unix()
+
+	cache := utils.NewMemoryCache()
+	if revoked := sessionRevoked(cache, sessionID, userID, revokedAt-1); revoked {
+		t.Fatal("sessão sem marca de revogação recusada")
+	}
+	if err := cache.Set(utils.Ctx, utils.UserRevokedBeforeKey(userID), strconv.FormatInt(revokedAt, 10), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		issuedAt int64
+		revoked  bool
+	}{
+		{"emitido antes da revogação", revokedAt - 1, true},
+		// Login logo depois de redefinir a senha, ainda no mesmo segundo
+		{"emitido no segundo da revogação", revokedAt, false},
+		{"emitido depois da revogação", revokedAt + 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionRevoked(cache, sessionID, userID, tt.issuedAt); got != tt.revoked {
+				t.Errorf("sessionRevoked = %v, esperado %v", got, tt.revoked)
+			}
+		})
+	}
+
+	if err := cache.Set(utils.Ctx, utils.SessionRevokedKey(sessionID), "1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !sessionRevoked(cache, sessionID, userID, revokedAt+1) {
+		t.Error("sessão encerrada no logout ainda aceita")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"database/sql/driver"
@@ -11,6 +12,7 @@ import (
 	"errors"
 
 	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -37,17 +39,259 @@ type User struct {
 	Name      string     `gorm:"not null"`
 	Email     string     `gorm:"not null;unique"`
 	Roles     RolesArray `gorm:"type:json"`
-	Password  string     `gorm:"not null"`
+	Password  string     `json:"-" gorm:"not null"`
 	IsAdmin   bool       `json:"is_admin" gorm:"default:false"`
 	PhotoURL  string     `json:"photo_url"`
 	CreatedAt time.Time
+
+	// Nil enquanto o voluntário não confirmar o e-mail pelo link enviado no cadastro.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// Situação do cadastro: novos voluntários aguardam aprovação de um admin.
+	Status string `json:"status" gorm:"not null;default:approved;index"`
+
+	// Privilégios de sistema; as funções no ministério (câmera, projeção...) ficam em Roles.
+	SystemRoles []SystemRole `json:"system_roles,omitempty" gorm:"many2many:user_system_roles"`
+
+	// Preenchido quando o voluntário é desativado (saiu do ministério); consultas
+	// normais deixam de encontrá-lo, mas o histórico de check-ins é mantido.
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+
+	// Verificação em duas etapas (TOTP). O segredo é gravado ao iniciar a configuração
+	// e só passa a ser exigido no login depois de confirmado com um código (TOTPEnabledAt).
+	// TOTPLastStep guarda o passo do último código aceito, para impedir reuso.
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	TOTPLastStep  int64      `json:"-" gorm:"not null;default:0"`
 }
 
+// Situações do cadastro do voluntário (User.Status).
+const (
+	UserStatusPending  = "pending"
+	UserStatusApproved = "approved"
+	UserStatusRejected = "rejected"
+)
+
+// Role é uma função do ministério (câmera, projeção...) do catálogo mantido pelos
+// admins. User.Roles guarda os slugs das funções.
+type Role struct {
+	ID          uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name        string    `json:"name" gorm:"not null;unique"`
+	Slug        string    `json:"slug" gorm:"not null;unique"`
+	Description string    `json:"description"`
+	Color       string    `json:"color"`
+	Active      bool      `json:"active" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Permissões de sistema, atribuídas aos usuários por meio de SystemRole.
+// Admins (IsAdmin) têm todas.
+const (
+	PermissionQRManage       = "qr:manage"       // gerar e resetar QR Codes
+	PermissionCheckinsRead   = "checkins:read"   // listar todos os check-ins
+	PermissionCheckinsManage = "checkins:manage" // check-in manual e correções
+	PermissionCheckinsTeam   = "checkins:team"   // check-in manual e correções só nas equipes do usuário
+	PermissionUsersManage    = "users:manage"    // cadastrar voluntários
+	PermissionScheduleManage = "schedule:manage" // horários de culto e eventos
+	PermissionDashboardTeam  = "dashboard:team"  // dashboards filtrados pelas equipes do usuário
+)
+
+var AllPermissions = []string{
+	PermissionQRManage,
+	PermissionCheckinsRead,
+	PermissionCheckinsManage,
+	PermissionCheckinsTeam,
+	PermissionUsersManage,
+	PermissionScheduleManage,
+	PermissionDashboardTeam,
+}
+
+// SystemRole agrupa permissões de sistema (ex.: "team_leader").
+type SystemRole struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name        string     `json:"name" gorm:"not null;unique"`
+	Description string     `json:"description"`
+	Permissions RolesArray `json:"permissions" gorm:"type:json"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Permissions retorna as permissões efetivas do usuário. SystemRoles precisa estar carregado.
+func (u User) Permissions() []string {
+	if u.IsAdmin {
+		return AllPermissions
+	}
+
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, role := range u.SystemRoles {
+		for _, permission := range role.Permissions {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions
+}
+
+// ValidPermission indica se a permissão existe.
+func ValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// VolunteerCheckin registra a presença de um voluntário em um evento.
+// O índice idx_checkin_user_event garante um único check-in por voluntário em cada evento.
 type VolunteerCheckin struct {
-	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	UserID      uuid.UUID `gorm:"not null"`
-	User        User      `gorm:"foreignKey:UserID;references:ID"`
-	CheckinTime time.Time `gorm:"autoCreateTime"`
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID      uuid.UUID  `gorm:"not null;uniqueIndex:idx_checkin_user_event"`
+	User        User       `gorm:"foreignKey:UserID;references:ID"`
+	EventID     *uuid.UUID `gorm:"type:uuid;index;uniqueIndex:idx_checkin_user_event"`
+	Event       *Event     `gorm:"foreignKey:EventID;references:ID"`
+	CheckinTime time.Time  `gorm:"autoCreateTime"`
+	Source      string     `gorm:"not null;default:qr"` // "qr" ou "manual"
+}
+
+// CheckinAudit registra as alterações feitas manualmente por admins nos check-ins:
+// quem fez, por quê e quais eram os horários antes e depois.
+type CheckinAudit struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	CheckinID    uuid.UUID  `json:"checkin_id" gorm:"type:uuid;not null;index"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	ActorID      uuid.UUID  `json:"actor_id" gorm:"type:uuid;not null"`
+	Action       string     `json:"action" gorm:"not null"` // "create", "update" ou "delete"
+	Reason       string     `json:"reason" gorm:"not null"`
+	PreviousTime *time.Time `json:"previous_time"`
+	NewTime      *time.Time `json:"new_time"`
+	EventID      *uuid.UUID `json:"event_id" gorm:"type:uuid"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RefreshToken é um token de renovação de sessão. Só o hash SHA-256 do token é
+// salvo. A cada renovação o token usado é revogado e substituído por outro da
+// mesma sessão (SessionID); o reuso de um token revogado derruba a sessão inteira.
+type RefreshToken struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	SessionID  uuid.UUID  `json:"session_id" gorm:"type:uuid;not null;index"`
+	TokenHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy *uuid.UUID `json:"replaced_by" gorm:"type:uuid"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// PasswordResetToken é um link de redefinição de senha. Só o hash SHA-256 do
+// token é salvo; o token vale uma única vez (UsedAt) até ExpiresAt.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// EmailVerificationToken é o link de confirmação de e-mail enviado no cadastro.
+// Como em PasswordResetToken, só o hash é salvo e o token vale uma única vez.
+type EmailVerificationToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Invitation é um convite para entrar no ministério. Quem se cadastra pelo link
+// entra já aprovado, com o e-mail confirmado e com as funções definidas no convite.
+type Invitation struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Email      string     `json:"email" gorm:"not null;index"`
+	Roles      RolesArray `json:"roles" gorm:"type:json"`
+	TokenHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	InvitedBy  uuid.UUID  `json:"invited_by" gorm:"type:uuid;not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	AcceptedBy *uuid.UUID `json:"accepted_by" gorm:"type:uuid"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RecoveryCode é um código de recuperação da verificação em duas etapas, para quem
+// perdeu o celular. Só o hash é salvo e cada código vale uma única vez.
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Setting é uma configuração do sistema ajustável pelos admins.
+type Setting struct {
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Value     string    `json:"value" gorm:"not null"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Configurações conhecidas e seus valores padrão.
+const (
+	SettingAllowUnverifiedCheckin = "allow_unverified_checkin" // voluntários sem e-mail confirmado podem fazer check-in
+	SettingRequireAdminTwoFactor  = "require_admin_2fa"        // admins precisam ativar a verificação em duas etapas
+)
+
+var DefaultSettings = map[string]string{
+	SettingAllowUnverifiedCheckin: "false",
+	SettingRequireAdminTwoFactor:  "false",
+}
+
+// GetSetting retorna o valor da configuração, ou o padrão se ela nunca foi alterada.
+func GetSetting(db *gorm.DB, key string) (string, error) {
+	var setting Setting
+	err := db.First(&setting, "key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultSettings[key], nil
+	}
+	return setting.Value, err
+}
+
+// GetBoolSetting é GetSetting para configurações do tipo true/false.
+func GetBoolSetting(db *gorm.DB, key string) (bool, error) {
+	value, err := GetSetting(db, key)
+	return value == "true", err
+}
+
+// ServiceSchedule representa um culto recorrente (dia da semana + horário de início).
+// StartTime é salvo no formato "15:04", no fuso de America/Sao_Paulo.
+type ServiceSchedule struct {
+	ID        uuid.UUID    `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Weekday   time.Weekday `json:"weekday" gorm:"not null"`
+	StartTime string       `json:"start_time" gorm:"not null"`
+	Title     string       `json:"title"`
+	Cancelled bool         `json:"cancelled" gorm:"default:false"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Event é uma ocorrência concreta de culto/evento, à qual os check-ins são vinculados.
+// Pode ser gerado a partir de um ServiceSchedule (ScheduleID) ou cadastrado avulso.
+type Event struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Title         string     `json:"title" gorm:"not null"`
+	Date          time.Time  `json:"date" gorm:"type:date;not null;index"`
+	StartTime     time.Time  `json:"start_time" gorm:"not null;uniqueIndex:idx_event_schedule_start"`
+	Location      string     `json:"location"`
+	ExpectedTeams RolesArray `json:"expected_teams" gorm:"type:json"`
+	ScheduleID    *uuid.UUID `json:"schedule_id" gorm:"type:uuid;uniqueIndex:idx_event_schedule_start"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 type LoginInput struct {
@@ -70,9 +314,141 @@ func InitDB() {
 		log.Fatal("Erro ao conectar com o banco de dados:", err)
 	}
 
-	err = database.AutoMigrate(&User{}, &VolunteerCheckin{})
-	if err != nil {
+	if err := Migrate(database); err != nil {
 		log.Fatal("Erro ao fazer AutoMigrate:", err)
 	}
 	DB = database
 }
+
+// Migrate cria/atualiza as tabelas e popula os dados iniciais necessários.
+func Migrate(db *gorm.DB) error {
+	// Contas criadas antes da confirmação de e-mail existir são consideradas confirmadas
+	backfillEmailVerified := db.Migrator().HasTable(&User{}) && !db.Migrator().HasColumn(&User{}, "EmailVerifiedAt")
+
+	if err := db.AutoMigrate(
+		&User{}, &Role{}, &SystemRole{}, &Event{}, &VolunteerCheckin{}, &CheckinAudit{}, &ServiceSchedule{},
+		&RefreshToken{}, &PasswordResetToken{}, &EmailVerificationToken{}, &Invitation{}, &Setting{},
+		&RecoveryCode{},
+	); err != nil {
+		return err
+	}
+	if backfillEmailVerified {
+		if err := db.Model(&User{}).Where("email_verified_at IS NULL").
+			Update("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			return err
+		}
+	}
+	if err := normalizeUserRoles(db); err != nil {
+		return err
+	}
+	if err := seedSystemRoles(db); err != nil {
+		return err
+	}
+	return seedServiceSchedules(db)
+}
+
+// normalizeUserRoles converte as funções em texto livre já gravadas nos usuários
+// ("Câmera", "camera ", ...) para o slug do catálogo, cadastrando no catálogo as
+// funções que ainda não existem. Usuários já normalizados não são alterados.
+func normalizeUserRoles(db *gorm.DB) error {
+	var roles []Role
+	if err := db.Find(&roles).Error; err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		known[role.Slug] = true
+	}
+
+	var users []User
+	if err := db.Select("id", "roles").Find(&users).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			normalized := RolesArray{}
+			seen := make(map[string]bool)
+			for _, name := range user.Roles {
+				slug := utils.Slugify(name)
+				if slug == "" || seen[slug] {
+					continue
+				}
+				seen[slug] = true
+				normalized = append(normalized, slug)
+
+				if !known[slug] {
+					role := Role{Name: strings.TrimSpace(name), Slug: slug, Active: true}
+					if err := tx.Where(Role{Slug: slug}).FirstOrCreate(&role).Error; err != nil {
+						return err
+					}
+					known[slug] = true
+				}
+			}
+
+			if equalRoles(user.Roles, normalized) {
+				continue
+			}
+			if err := tx.Model(&User{}).Where("id = ?", user.ID).Update("roles", normalized).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func equalRoles(a, b RolesArray) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// seedSystemRoles cadastra o papel de líder de equipe, caso ainda não exista. O
+// papel criado por versões anteriores, com checkins:manage (check-ins de qualquer
+// equipe), passa a ter checkins:team se ainda estiver com as permissões padrão.
+func seedSystemRoles(db *gorm.DB) error {
+	teamLeader := SystemRole{
+		Name:        "team_leader",
+		Description: "Líder de equipe: vê o dashboard da sua equipe e faz check-ins manuais nela",
+		Permissions: RolesArray{PermissionDashboardTeam, PermissionCheckinsTeam},
+	}
+	if err := db.Where(SystemRole{Name: teamLeader.Name}).FirstOrCreate(&teamLeader).Error; err != nil {
+		return err
+	}
+	if equalRoles(teamLeader.Permissions, RolesArray{PermissionDashboardTeam, PermissionCheckinsManage}) {
+		return db.Model(&teamLeader).Updates(map[string]interface{}{
+			"description": "Líder de equipe: vê o dashboard da sua equipe e faz check-ins manuais nela",
+			"permissions": RolesArray{PermissionDashboardTeam, PermissionCheckinsTeam},
+		}).Error
+	}
+	return nil
+}
+
+// seedServiceSchedules cadastra os horários de culto padrão quando a tabela está vazia.
+func seedServiceSchedules(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&ServiceSchedule{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	defaults := []ServiceSchedule{
+		{Weekday: time.Sunday, StartTime: "09:00", Title: "Culto da manhã"},
+		{Weekday: time.Sunday, StartTime: "17:00", Title: "Culto da noite"},
+		{Weekday: time.Monday, StartTime: "19:00", Title: "Culto"},
+		{Weekday: time.Tuesday, StartTime: "19:00", Title: "Culto"},
+		{Weekday: time.Wednesday, StartTime: "19:00", Title: "Culto"},
+		{Weekday: time.Thursday, StartTime: "19:00", Title: "Culto"},
+		{Weekday: time.Friday, StartTime: "19:00", Title: "Culto"},
+		{Weekday: time.Saturday, StartTime: "18:00", Title: "Culto"},
+	}
+	return db.Create(&defaults).Error
+}
@@ -4,41 +4,63 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/nicolaslucianob/checkinfp/controllers"
 	"github.com/nicolaslucianob/checkinfp/middlewares"
+	"github.com/nicolaslucianob/checkinfp/models"
+	"github.com/nicolaslucianob/checkinfp/utils"
 	"gorm.io/gorm"
 )
 
-func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
+func RegisterRoutes(r *gin.Engine, db *gorm.DB, cache utils.Cache, store utils.Storage, mailer utils.Mailer) {
+	// Arquivos gravados pelo storage local
+	if local, ok := store.(*utils.LocalStorage); ok {
+		r.Static(local.Route(), local.Dir)
+	}
+
 	// Public Routes
-	r.POST("/signup", func(c *gin.Context) { controllers.SignUp(c, db) })
-	r.POST("/login", func(c *gin.Context) { controllers.Login(c, db) })
-	r.POST("/forgot-password", func(c *gin.Context) { controllers.ForgotPassword(c, db) })
-	r.POST("/reset-password", func(c *gin.Context) { controllers.ResetPassword(c, db) })
+	r.GET("/health", func(c *gin.Context) { controllers.HealthCheck(c, db, cache) })
+	r.POST("/signup", func(c *gin.Context) { controllers.SignUp(c, db, mailer) })
+	r.GET("/signup/invite", func(c *gin.Context) { controllers.GetInvitation(c, db) })
+	r.POST("/signup/invite", func(c *gin.Context) { controllers.SignUpWithInvite(c, db) })
+	r.POST("/login", func(c *gin.Context) { controllers.Login(c, db, cache) })
+	r.POST("/login/2fa", func(c *gin.Context) { controllers.LoginTwoFactor(c, db, cache) })
+	r.POST("/token/refresh", func(c *gin.Context) { controllers.RefreshToken(c, db, cache) })
+	r.POST("/forgot-password", func(c *gin.Context) { controllers.ForgotPassword(c, db, mailer) })
+	r.POST("/reset-password", func(c *gin.Context) { controllers.ResetPassword(c, db, cache) })
+	r.GET("/verify-email", func(c *gin.Context) { controllers.VerifyEmail(c, db) })
+	r.GET("/roles", func(c *gin.Context) { controllers.ListRoles(c, db, false) })
 
 	// r.GET("/generate/qr", controllers.GenerateQRCode) // Public route for QR code generation
 
-	// Protected Routes
+	// Volunteer Routes (any authenticated user)
 	auth := r.Group("/")
-	auth.Use(middlewares.AuthMiddleware())
-
-	// QR Code
-	auth.GET("/generate/qr", controllers.GenerateQRCode)
-	auth.POST("/generate/qr/reset", controllers.RegenerateQRCode)
+	auth.Use(middlewares.AuthMiddleware(db, cache))
 
 	// Authenticated User Info
 	auth.GET("/me", func(c *gin.Context) { controllers.GetMe(c, db) })
-	auth.PUT("/me", func(c *gin.Context) { controllers.UpdateProfile(c, db) })
+	auth.PUT("/me", func(c *gin.Context) { controllers.UpdateProfile(c, db, cache, mailer) })
+	auth.POST("/me/verify-email", func(c *gin.Context) { controllers.ResendVerificationEmail(c, db, mailer) })
+	auth.POST("/logout", func(c *gin.Context) { controllers.Logout(c, db, cache) })
+	auth.POST("/me/photo", func(c *gin.Context) { controllers.UploadProfilePhoto(c, db, store) })
+
+	// Two-factor authentication
+	auth.POST("/me/2fa/setup", func(c *gin.Context) { controllers.SetupTwoFactor(c, db) })
+	auth.POST("/me/2fa/enable", func(c *gin.Context) { controllers.EnableTwoFactor(c, db, cache) })
+	auth.POST("/me/2fa/disable", func(c *gin.Context) { controllers.DisableTwoFactor(c, db, cache) })
+	auth.POST("/me/2fa/recovery-codes", func(c *gin.Context) { controllers.RegenerateRecoveryCodes(c, db) })
 
 	// Check-in
-	auth.POST("/checkin", func(c *gin.Context) { controllers.CheckIn(c, db) })
-	auth.GET("/checkins", func(c *gin.Context) { controllers.ListCheckins(c, db) })
+	auth.POST("/checkin", func(c *gin.Context) { controllers.CheckIn(c, db, cache) })
 	auth.GET("/checkin/last", func(c *gin.Context) { controllers.GetLastCheckin(c, db) })
 	auth.GET("/ranking", func(c *gin.Context) { controllers.CheckinRanking(c, db) })
 
 	// Volunteers
-	auth.POST("/volunteers", func(c *gin.Context) { controllers.CreateVolunteer(c, db) })
 	auth.GET("/volunteers", func(c *gin.Context) { controllers.ListVolunteers(c, db) })
 	auth.GET("/volunteers/:id", func(c *gin.Context) { controllers.GetVolunteerByID(c, db) })
 
+	// Service schedules and events
+	auth.GET("/schedules", func(c *gin.Context) { controllers.ListServiceSchedules(c, db) })
+	auth.GET("/events", func(c *gin.Context) { controllers.ListEvents(c, db) })
+	auth.GET("/events/:id", func(c *gin.Context) { controllers.GetEvent(c, db) })
+
 	// Dashboard
 	auth.GET("/dashboard", func(c *gin.Context) { controllers.GetVolunteerDashboardData(c, db) })
 	auth.GET("/dashboard/punctuality-ranking", func(c *gin.Context) { controllers.GetPunctualityRanking(c, db) })
@@ -46,4 +68,72 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB) {
 	auth.GET("/dashboard/punctuality-meter", func(c *gin.Context) { controllers.GetPunctualityMeter(c, db) })
 	auth.GET("/dashboard/checkin-scatter", func(c *gin.Context) { controllers.GetCheckinScatterData(c, db) })
 	auth.GET("/dashboard/checkin-history", func(c *gin.Context) { controllers.GetCheckinHistory(c, db) })
+
+	// Routes guarded by a system permission (admins have all of them)
+	qr := auth.Group("/generate/qr", middlewares.RequirePermission(models.PermissionQRManage))
+	qr.GET("", func(c *gin.Context) { controllers.GenerateQRCode(c, db, cache, store) })
+	qr.POST("/reset", func(c *gin.Context) { controllers.RegenerateQRCode(c, cache) })
+	qr.GET("/image", func(c *gin.Context) { controllers.GetQRCodeImage(c, cache) })
+	qr.GET("/current", func(c *gin.Context) { controllers.GetCurrentQRCode(c, cache) })
+	qr.GET("/stream", func(c *gin.Context) { controllers.StreamQRCode(c, cache) })
+
+	// Check-ins
+	auth.GET("/checkins", middlewares.RequirePermission(models.PermissionCheckinsRead), func(c *gin.Context) { controllers.ListCheckins(c, db) })
+	checkins := auth.Group("/checkins", middlewares.RequireAnyPermission(models.PermissionCheckinsManage, models.PermissionCheckinsTeam))
+	checkins.POST("/manual", func(c *gin.Context) { controllers.CreateManualCheckin(c, db) })
+	checkins.PUT("/:id", func(c *gin.Context) { controllers.UpdateCheckin(c, db, cache) })
+	checkins.DELETE("/:id", func(c *gin.Context) { controllers.DeleteCheckin(c, db, cache) })
+	checkins.GET("/:id/audit", func(c *gin.Context) { controllers.GetCheckinAudit(c, db) })
+
+	// Volunteers
+	volunteers := auth.Group("/volunteers", middlewares.RequirePermission(models.PermissionUsersManage))
+	volunteers.POST("", func(c *gin.Context) { controllers.CreateVolunteer(c, db) })
+	volunteers.GET("/pending", func(c *gin.Context) { controllers.ListPendingVolunteers(c, db) })
+	volunteers.POST("/:id/approve", func(c *gin.Context) { controllers.ApproveVolunteer(c, db) })
+	volunteers.POST("/:id/reject", func(c *gin.Context) { controllers.RejectVolunteer(c, db, cache) })
+	volunteers.POST("/:id/unlock", func(c *gin.Context) { controllers.UnlockLogin(c, db, cache) })
+
+	// Invitations
+	invitations := auth.Group("/invitations", middlewares.RequirePermission(models.PermissionUsersManage))
+	invitations.GET("", func(c *gin.Context) { controllers.ListInvitations(c, db) })
+	invitations.POST("", func(c *gin.Context) { controllers.CreateInvitation(c, db, mailer) })
+	invitations.DELETE("/:id", func(c *gin.Context) { controllers.RevokeInvitation(c, db) })
+
+	// Service schedules and events
+	schedule := auth.Group("/", middlewares.RequirePermission(models.PermissionScheduleManage))
+	schedule.POST("/schedules", func(c *gin.Context) { controllers.CreateServiceSchedule(c, db) })
+	schedule.PUT("/schedules/:id", func(c *gin.Context) { controllers.UpdateServiceSchedule(c, db) })
+	schedule.DELETE("/schedules/:id", func(c *gin.Context) { controllers.DeleteServiceSchedule(c, db) })
+	schedule.POST("/events", func(c *gin.Context) { controllers.CreateEvent(c, db) })
+	schedule.PUT("/events/:id", func(c *gin.Context) { controllers.UpdateEvent(c, db) })
+	schedule.DELETE("/events/:id", func(c *gin.Context) { controllers.DeleteEvent(c, db) })
+
+	// Admin Routes
+	admin := r.Group("/")
+	admin.Use(middlewares.AuthMiddleware(db, cache), middlewares.RequireAdmin())
+
+	// Settings
+	admin.GET("/settings", func(c *gin.Context) { controllers.ListSettings(c, db) })
+	admin.PUT("/settings", func(c *gin.Context) { controllers.UpdateSettings(c, db) })
+
+	// Ministry role catalog
+	admin.GET("/roles/all", func(c *gin.Context) { controllers.ListRoles(c, db, true) })
+	admin.POST("/roles", func(c *gin.Context) { controllers.CreateRole(c, db) })
+	admin.PUT("/roles/:id", func(c *gin.Context) { controllers.UpdateRole(c, db) })
+	admin.DELETE("/roles/:id", func(c *gin.Context) { controllers.DeleteRole(c, db) })
+
+	// System roles and permissions
+	admin.GET("/access-roles", func(c *gin.Context) { controllers.ListSystemRoles(c, db) })
+	admin.POST("/access-roles", func(c *gin.Context) { controllers.CreateSystemRole(c, db) })
+	admin.PUT("/access-roles/:id", func(c *gin.Context) { controllers.UpdateSystemRole(c, db) })
+	admin.DELETE("/access-roles/:id", func(c *gin.Context) { controllers.DeleteSystemRole(c, db) })
+	admin.GET("/volunteers/:id/sessions", func(c *gin.Context) { controllers.ListUserSessions(c, db) })
+	admin.POST("/volunteers/:id/sessions/revoke", func(c *gin.Context) { controllers.RevokeUserSessions(c, db, cache) })
+	admin.DELETE("/volunteers/:id/2fa", func(c *gin.Context) { controllers.ResetUserTwoFactor(c, db, cache) })
+	admin.GET("/volunteers/deactivated", func(c *gin.Context) { controllers.ListDeactivatedUsers(c, db) })
+	admin.PUT("/volunteers/:id/admin", func(c *gin.Context) { controllers.SetUserAdmin(c, db, cache) })
+	admin.POST("/volunteers/:id/deactivate", func(c *gin.Context) { controllers.DeactivateUser(c, db, cache) })
+	admin.POST("/volunteers/:id/reactivate", func(c *gin.Context) { controllers.ReactivateUser(c, db) })
+	admin.DELETE("/volunteers/:id", func(c *gin.Context) { controllers.DeleteUser(c, db, cache) })
+	admin.PUT("/volunteers/:id/access-roles", func(c *gin.Context) { controllers.SetUserSystemRoles(c, db) })
 }
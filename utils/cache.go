@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCacheMiss é retornado por Get quando a chave não existe ou expirou.
+var ErrCacheMiss = errors.New("chave não encontrada no cache")
+
+// Cache é o subconjunto de operações de cache usado pela API.
+// TTL segue a convenção do Redis: -2 se a chave não existe, -1 se não expira.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+	// Incr soma 1 ao contador e devolve o novo valor. O ttl só é aplicado quando
+	// o contador é criado, então a janela conta a partir da primeira ocorrência.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	HSet(ctx context.Context, key string, values map[string]string, ttl time.Duration) error
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Del(ctx context.Context, keys ...string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// NewCache escolhe a implementação pelo CACHE_DRIVER (redis ou memory).
+// Sem configuração, usa o Redis quando REDIS_ADDR está definido e a memória caso contrário.
+func NewCache() (Cache, error) {
+	driver := strings.ToLower(os.Getenv("CACHE_DRIVER"))
+	if driver == "" {
+		driver = "memory"
+		if os.Getenv("REDIS_ADDR") != "" {
+			driver = "redis"
+		}
+	}
+
+	switch driver {
+	case "redis":
+		return NewRedisCache(NewRedisClient()), nil
+	case "memory":
+		return NewMemoryCache(), nil
+	}
+	return nil, fmt.Errorf("CACHE_DRIVER desconhecido: %s", driver)
+}
+
+// RedisCache implementa Cache sobre um único cliente go-redis, cujo pool de
+// conexões é compartilhado por todas as requisições.
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	val, err := r.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrCacheMiss
+	}
+	return val, err
+}
+
+func (r *RedisCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (r *RedisCache) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+// incrScript soma 1 e aplica o ttl numa única operação atômica, para que o
+// contador nunca fique sem expiração (o que deixaria uma conta bloqueada para
+// sempre). Um contador que tenha ficado sem ttl também recebe o ttl aqui.
+var incrScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+local ttl = tonumber(ARGV[1])
+if ttl > 0 and (n == 1 or redis.call("PTTL", KEYS[1]) == -1) then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return n
+`)
+
+func (r *RedisCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return incrScript.Run(ctx, r.client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+func (r *RedisCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return r.client.HGetAll(ctx, key).Result()
+}
+
+func (r *RedisCache) HSet(ctx context.Context, key string, values map[string]string, ttl time.Duration) error {
+	fields := make(map[string]interface{}, len(values))
+	for field, value := range values {
+		fields[field] = value
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, fields)
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return r.client.TTL(ctx, key).Result()
+}
+
+func (r *RedisCache) Del(ctx context.Context, keys ...string) error {
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *RedisCache) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := r.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *RedisCache) Close() error {
+	return r.client.Close()
+}
+
+// MemoryCache é um Cache em memória do processo, com expiração por TTL.
+// Serve para desenvolvimento local e testes; não é compartilhado entre instâncias.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value     string
+	hash      map[string]string
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+func NewMemoryCache() *MemoryCache {
+	m := &MemoryCache{entries: make(map[string]memoryEntry)}
+	go m.janitor(time.Minute)
+	return m
+}
+
+// janitor remove periodicamente as chaves expiradas.
+func (m *MemoryCache) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.mu.Lock()
+		for key, entry := range m.entries {
+			if entry.expired(now) {
+				delete(m.entries, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// lookup retorna a entrada viva da chave; deve ser chamado com o mutex travado.
+func (m *MemoryCache) lookup(key string) (memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if entry.expired(time.Now()) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key)
+	if !ok || entry.hash != nil {
+		return "", ErrCacheMiss
+	}
+	return entry.value, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = memoryEntry{value: value, expiresAt: expiresAt(ttl)}
+	return nil
+}
+
+func (m *MemoryCache) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lookup(key); ok {
+		return false, nil
+	}
+	m.entries[key] = memoryEntry{value: value, expiresAt: expiresAt(ttl)}
+	return true, nil
+}
+
+func (m *MemoryCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key)
+	if !ok {
+		m.entries[key] = memoryEntry{value: "1", expiresAt: expiresAt(ttl)}
+		return 1, nil
+	}
+	if entry.hash != nil {
+		return 0, errors.New("a chave não guarda um contador")
+	}
+	n, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, errors.New("a chave não guarda um contador")
+	}
+	n++
+	entry.value = strconv.FormatInt(n, 10)
+	m.entries[key] = entry
+	return n, nil
+}
+
+func (m *MemoryCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make(map[string]string)
+	if entry, ok := m.lookup(key); ok {
+		for field, value := range entry.hash {
+			result[field] = value
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryCache) HSet(ctx context.Context, key string, values map[string]string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := make(map[string]string, len(values))
+	for field, value := range values {
+		hash[field] = value
+	}
+	m.entries[key] = memoryEntry{hash: hash, expiresAt: expiresAt(ttl)}
+	return nil
+}
+
+func (m *MemoryCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key)
+	if !ok {
+		return -2, nil
+	}
+	if entry.expiresAt.IsZero() {
+		return -1, nil
+	}
+	return time.Until(entry.expiresAt), nil
+}
+
+func (m *MemoryCache) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+func (m *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.lookup(key)
+	return ok, nil
+}
+
+func (m *MemoryCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryCache) Close() error {
+	return nil
+}
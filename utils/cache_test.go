@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testCaches devolve a MemoryCache e, com TEST_REDIS_ADDR definido, também a RedisCache.
+func testCaches(t *testing.T) map[string]Cache {
+	t.Helper()
+	caches := map[string]Cache{"memory": NewMemoryCache()}
+	if addr := os.Getenv("TEST_REDIS_ADDR"); addr != "" {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		t.Cleanup(func() { client.Close() })
+		caches["redis"] = NewRedisCache(client)
+	}
+	return caches
+}
+
+func TestCacheIncrSetsTTL(t *testing.T) {
+	ctx := context.Background()
+	for name, cache := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			key := "checkinfp:test:incr:" + GenerateRandomToken()
+			t.Cleanup(func() { cache.Del(ctx, key) })
+
+			for want := int64(1); want <= 3; want++ {
+				n, err := cache.Incr(ctx, key, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != want {
+					t.Errorf("Incr = %d, esperado %d", n, want)
+				}
+			}
+			ttl, err := cache.TTL(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttl <= 0 || ttl > time.Minute {
+				t.Errorf("TTL = %s, esperado até 1m", ttl)
+			}
+		})
+	}
+}
+
+// Um contador que ficou sem expiração (ex.: criado por uma versão antiga, que
+// fazia INCR e EXPIRE separados) recebe o ttl no próximo Incr.
+func TestRedisCacheIncrRestoresMissingTTL(t *testing.T) {
+	cache, ok := testCaches(t)["redis"]
+	if !ok {
+		t.Skip("TEST_REDIS_ADDR não definido")
+	}
+	ctx := context.Background()
+	key := "checkinfp:test:incr:" + GenerateRandomToken()
+	t.Cleanup(func() { cache.Del(ctx, key) })
+
+	if err := cache.Set(ctx, key, "5", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Incr(ctx, key, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _ := cache.TTL(ctx, key); ttl <= 0 {
+		t.Errorf("TTL = %s, esperado positivo", ttl)
+	}
+}
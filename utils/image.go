@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("formato de imagem não suportado")
+	ErrImageTooLarge    = errors.New("dimensões da imagem acima do limite")
+)
+
+// maxPhotoPixels limita a área (largura × altura) das fotos aceitas: 40 megapixels.
+const maxPhotoPixels = 40_000_000
+
+// ProcessProfilePhoto valida a imagem enviada (JPEG, PNG ou GIF), reduz para no
+// máximo maxSize pixels no maior lado e devolve o resultado em JPEG.
+func ProcessProfilePhoto(data []byte, maxSize int) ([]byte, error) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, ErrUnsupportedImage
+	}
+
+	// Confere as dimensões antes de decodificar: um arquivo pequeno pode declarar
+	// uma imagem enorme e esgotar a memória
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 ||
+		config.Width > maxPhotoPixels/config.Height {
+		return nil, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, ResizeImage(img, maxSize), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ResizeImage reduz a imagem (mantendo a proporção) para que o maior lado tenha
+// no máximo maxSize pixels, tirando a média dos pixels de origem de cada pixel final.
+func ResizeImage(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW <= maxSize && srcH <= maxSize {
+		return img
+	}
+
+	dstW, dstH := maxSize, maxSize
+	if srcW > srcH {
+		dstH = max(1, srcH*maxSize/srcW)
+	} else {
+		dstW = max(1, srcW*maxSize/srcH)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcH/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcW/dstW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
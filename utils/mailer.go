@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var emailTemplates embed.FS
+
+// Email é uma mensagem pronta para envio.
+type Email struct {
+	To      string
+	Subject string
+	HTML    string
+}
+
+// Mailer entrega os e-mails da aplicação.
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// NewMailer escolhe a implementação pelo MAIL_DRIVER (brevo, smtp ou outbox).
+// Sem configuração, usa o Brevo quando BREVO_API_KEY está definida e o outbox caso contrário.
+func NewMailer() (Mailer, error) {
+	driver := strings.ToLower(os.Getenv("MAIL_DRIVER"))
+	if driver == "" {
+		driver = "outbox"
+		if os.Getenv("BREVO_API_KEY") != "" {
+			driver = "brevo"
+		}
+	}
+
+	fromName, fromEmail := mailSender()
+	switch driver {
+	case "brevo":
+		apiKey := os.Getenv("BREVO_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("BREVO_API_KEY não configurada")
+		}
+		return &BrevoMailer{APIKey: apiKey, FromName: fromName, FromEmail: fromEmail, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST não configurado")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:      host,
+			Port:      port,
+			Username:  os.Getenv("SMTP_USER"),
+			Password:  os.Getenv("SMTP_PASS"),
+			FromName:  fromName,
+			FromEmail: fromEmail,
+		}, nil
+	case "outbox":
+		return &OutboxMailer{Dir: os.Getenv("MAIL_OUTBOX_DIR")}, nil
+	}
+	return nil, fmt.Errorf("MAIL_DRIVER desconhecido: %s", driver)
+}
+
+// mailSender retorna o remetente configurado, aceitando as variáveis antigas do Brevo.
+func mailSender() (string, string) {
+	name := os.Getenv("MAIL_FROM_NAME")
+	if name == "" {
+		name = os.Getenv("BREVO_NAME")
+	}
+	email := os.Getenv("MAIL_FROM_EMAIL")
+	if email == "" {
+		email = os.Getenv("BREVO_SENDER_EMAIL")
+	}
+	return name, email
+}
+
+// RenderEmail monta o e-mail a partir de templates/<name>.html, que define os
+// blocos "subject" e "body".
+func RenderEmail(name string, to string, data interface{}) (Email, error) {
+	tmpl, err := template.ParseFS(emailTemplates, "templates/"+name+".html")
+	if err != nil {
+		return Email{}, err
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Email{}, err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return Email{}, err
+	}
+	return Email{To: to, Subject: strings.TrimSpace(subject.String()), HTML: body.String()}, nil
+}
+
+// SendTemplate renderiza o template e envia o e-mail.
+func SendTemplate(ctx context.Context, mailer Mailer, name string, to string, data interface{}) error {
+	email, err := RenderEmail(name, to, data)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, email)
+}
+
+// FrontendURL monta um link para o frontend a partir de FRONTEND_URL.
+func FrontendURL(path string, query url.Values) string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "https://checkin-fp.vercel.app"
+	}
+	link := strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+// BrevoMailer envia pela API transacional do Brevo.
+type BrevoMailer struct {
+	APIKey    string
+	FromName  string
+	FromEmail string
+	Client    *http.Client
+}
+
+func (b *BrevoMailer) Send(ctx context.Context, email Email) error {
+	body := map[string]interface{}{
+		"sender": map[string]string{
+			"name":  b.FromName,
+			"email": b.FromEmail,
+		},
+		"to": []map[string]string{
+			{"email": email.To},
+		},
+		"subject":     email.Subject,
+		"htmlContent": email.HTML,
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.brevo.com/v3/smtp/email", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("api-key", b.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted && res.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("erro ao enviar e-mail: status %d, resposta: %s", res.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// SMTPMailer envia por um servidor SMTP (STARTTLS quando o servidor oferece).
+type SMTPMailer struct {
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	FromName  string
+	FromEmail string
+}
+
+func (s *SMTPMailer) Send(ctx context.Context, email Email) error {
+	from := s.FromEmail
+	if s.FromName != "" {
+		from = mime.QEncoding.Encode("utf-8", s.FromName) + " <" + s.FromEmail + ">"
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", email.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n\r\n")
+	msg.WriteString(email.HTML)
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.FromEmail, []string{email.To}, msg.Bytes())
+}
+
+// OutboxMailer não envia nada: grava cada e-mail como arquivo HTML em Dir (ou só
+// registra no log, se Dir estiver vazio). Serve para desenvolvimento e testes.
+type OutboxMailer struct {
+	Dir string
+}
+
+func (o *OutboxMailer) Send(ctx context.Context, email Email) error {
+	if o.Dir == "" {
+		log.Printf("📧 E-mail para %s: %s\n%s", email.To, email.Subject, email.HTML)
+		return nil
+	}
+
+	if err := os.MkdirAll(o.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.html", time.Now().Format("20060102-150405.000"), Slugify(email.To))
+	content := fmt.Sprintf("<!-- Para: %s -->\n<!-- Assunto: %s -->\n%s", email.To, email.Subject, email.HTML)
+	path := filepath.Join(o.Dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return err
+	}
+	log.Printf("📧 E-mail para %s gravado em %s", email.To, path)
+	return nil
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed passwords/common.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     map[string]bool
+)
+
+// Mensagens da política de senha, iguais em todos os fluxos (cadastro, convite,
+// redefinição e perfil).
+var (
+	ErrPasswordTooLong   = errors.New("*A senha pode ter no máximo 72 caracteres, irmão(ã)")
+	ErrPasswordPersonal  = errors.New("*A senha não pode ser igual ao seu nome ou e-mail, irmão(ã)")
+	ErrPasswordTooCommon = errors.New("*Essa senha é muito comum, escolha outra, irmão(ã)")
+)
+
+// BcryptCost é o custo usado nos novos hashes (BCRYPT_COST, padrão 14).
+func BcryptCost() int {
+	cost := EnvInt("BCRYPT_COST", 14)
+	if cost < bcrypt.MinCost {
+		return bcrypt.MinCost
+	}
+	if cost > bcrypt.MaxCost {
+		return bcrypt.MaxCost
+	}
+	return cost
+}
+
+func HashPassword(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost())
+	return string(bytes), err
+}
+
+func CheckPasswordHash(password, hash string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil
+}
+
+// PasswordNeedsRehash indica se o hash foi gerado com um custo diferente do
+// configurado e deve ser refeito no próximo login.
+func PasswordNeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != BcryptCost()
+}
+
+func isCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = make(map[string]bool)
+		scanner := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				commonPasswords[strings.ToLower(line)] = true
+			}
+		}
+	})
+	return commonPasswords[strings.ToLower(password)]
+}
+
+// ValidatePassword aplica a política de senha: tamanho mínimo (PASSWORD_MIN_LENGTH,
+// padrão 8), limite de 72 bytes do bcrypt, diferente do nome e do e-mail do
+// voluntário e fora da lista de senhas comuns.
+func ValidatePassword(password, name, email string) error {
+	min := EnvInt("PASSWORD_MIN_LENGTH", 8)
+	if len([]rune(password)) < min {
+		return fmt.Errorf("*A senha precisa ter pelo menos %d caracteres, irmão(ã)", min)
+	}
+	if len(password) > 72 {
+		return ErrPasswordTooLong
+	}
+
+	lowered := strings.ToLower(strings.TrimSpace(password))
+	email = strings.ToLower(strings.TrimSpace(email))
+	personal := []string{strings.ToLower(strings.TrimSpace(name)), email}
+	if local, _, ok := strings.Cut(email, "@"); ok {
+		personal = append(personal, local)
+	}
+	for _, value := range personal {
+		if value == "" {
+			continue
+		}
+		if lowered == value || lowered == strings.ReplaceAll(value, " ", "") {
+			return ErrPasswordPersonal
+		}
+	}
+
+	if isCommonPassword(lowered) {
+		return ErrPasswordTooCommon
+	}
+	return nil
+}
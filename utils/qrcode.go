@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// ParseQRLevel converte o nível de correção de erro recebido na query
+// (low, medium, high, highest) para o tipo do go-qrcode.
+func ParseQRLevel(level string) (qrcode.RecoveryLevel, bool) {
+	switch strings.ToLower(level) {
+	case "", "medium", "m":
+		return qrcode.Medium, true
+	case "low", "l":
+		return qrcode.Low, true
+	case "high", "q":
+		return qrcode.High, true
+	case "highest", "h":
+		return qrcode.Highest, true
+	}
+	return qrcode.Medium, false
+}
+
+// QRCodeSVG gera o QR Code em SVG, com size pixels de largura e altura.
+func QRCodeSVG(content string, level qrcode.RecoveryLevel, size int) (string, error) {
+	q, err := qrcode.New(content, level)
+	if err != nil {
+		return "", err
+	}
+	bitmap := q.Bitmap()
+	modules := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	return fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+			`<rect width="100%%" height="100%%" fill="#ffffff"/><path fill="#000000" d="%s"/></svg>`,
+		size, size, modules, modules, path.String(),
+	), nil
+}
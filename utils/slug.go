@@ -0,0 +1,33 @@
+package utils
+
+import "strings"
+
+var accentReplacer = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+// Slugify normaliza um nome para comparação e uso em URLs: minúsculas, sem
+// acentos e com palavras separadas por hífen ("Câmera Principal" → "camera-principal").
+func Slugify(s string) string {
+	s = accentReplacer.Replace(strings.ToLower(strings.TrimSpace(s)))
+
+	var b strings.Builder
+	pendingDash := false
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pendingDash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			pendingDash = false
+			continue
+		}
+		pendingDash = true
+	}
+	return b.String()
+}
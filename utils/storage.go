@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+)
+
+// Storage guarda arquivos (QR Codes, fotos de perfil) e devolve a URL pública deles.
+type Storage interface {
+	Save(ctx context.Context, key string, contentType string, data []byte) (string, error)
+}
+
+// NewStorage escolhe a implementação pelo STORAGE_DRIVER (cloudinary, local, s3 ou none).
+// Sem configuração, usa o Cloudinary quando há credenciais e "none" caso contrário.
+// Com "none", retorna nil: os QR Codes seguem como data URI e não há upload de fotos.
+func NewStorage() (Storage, error) {
+	driver := strings.ToLower(os.Getenv("STORAGE_DRIVER"))
+	if driver == "" {
+		driver = "none"
+		if CloudinaryConfigured() {
+			driver = "cloudinary"
+		}
+	}
+
+	switch driver {
+	case "cloudinary":
+		cld, err := InitCloudinary()
+		if err != nil {
+			return nil, fmt.Errorf("erro ao inicializar Cloudinary: %v", err)
+		}
+		return &CloudinaryStorage{cld: cld}, nil
+	case "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		// O frontend roda em outro host, então a URL precisa ser absoluta
+		urlPrefix := os.Getenv("STORAGE_LOCAL_URL")
+		parsed, err := url.Parse(urlPrefix)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			strings.Trim(parsed.Path, "/") == "" {
+			return nil, fmt.Errorf("STORAGE_LOCAL_URL deve ser uma URL absoluta com caminho (ex.: https://api.exemplo.com/uploads)")
+		}
+		return &LocalStorage{Dir: dir, URLPrefix: urlPrefix}, nil
+	case "s3":
+		s3 := &S3Storage{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+		}
+		if s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKey == "" || s3.SecretKey == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY e S3_SECRET_KEY são obrigatórios")
+		}
+		if s3.Region == "" {
+			s3.Region = "us-east-1"
+		}
+		return s3, nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("STORAGE_DRIVER desconhecido: %s", driver)
+}
+
+// CloudinaryConfigured indica se há credenciais do Cloudinary no ambiente.
+func CloudinaryConfigured() bool {
+	return os.Getenv("CLOUDINARY_CLOUD_NAME") != "" &&
+		os.Getenv("CLOUDINARY_API_KEY") != "" &&
+		os.Getenv("CLOUDINARY_API_SECRET") != ""
+}
+
+func InitCloudinary() (*cloudinary.Cloudinary, error) {
+	cld, err := cloudinary.NewFromParams(
+		os.Getenv("CLOUDINARY_CLOUD_NAME"),
+		os.Getenv("CLOUDINARY_API_KEY"),
+		os.Getenv("CLOUDINARY_API_SECRET"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return cld, nil
+}
+
+type CloudinaryStorage struct {
+	cld *cloudinary.Cloudinary
+}
+
+func (s *CloudinaryStorage) Save(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	publicID := strings.TrimSuffix(key, path.Ext(key))
+	uploadResult, err := s.cld.Upload.Upload(ctx, bytes.NewReader(data), uploader.UploadParams{
+		PublicID: publicID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("erro no upload para Cloudinary:\nArquivo: %s\nErro: %v", key, err)
+	}
+
+	log.Println("Upload concluído. URL:", uploadResult.SecureURL)
+	return uploadResult.SecureURL, nil
+}
+
+// LocalStorage grava os arquivos em Dir; eles são servidos pela própria API em
+// URLPrefix, uma URL absoluta.
+type LocalStorage struct {
+	Dir       string
+	URLPrefix string
+}
+
+// Route é o caminho de URLPrefix, onde a API serve os arquivos.
+func (s *LocalStorage) Route() string {
+	parsed, err := url.Parse(s.URLPrefix)
+	if err != nil || strings.Trim(parsed.Path, "/") == "" {
+		return "/uploads"
+	}
+	return strings.TrimSuffix(parsed.Path, "/")
+}
+
+func (s *LocalStorage) Save(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	target := filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+key)))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(target, data, 0o644); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(s.URLPrefix, "/") + path.Clean("/"+key), nil
+}
+
+// S3Storage envia arquivos para qualquer serviço compatível com S3 (AWS, MinIO,
+// Cloudflare R2...) assinando as requisições com AWS Signature V4.
+type S3Storage struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PublicURL string
+	PathStyle bool
+}
+
+func (s *S3Storage) objectURL(key string) string {
+	endpoint := s.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if s.PathStyle {
+		return endpoint + "/" + s.Bucket + "/" + s3EscapePath(key)
+	}
+	scheme, host, _ := strings.Cut(endpoint, "://")
+	return scheme + "://" + s.Bucket + "." + host + "/" + s3EscapePath(key)
+}
+
+func (s *S3Storage) Save(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	objectURL := s.objectURL(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, data, time.Now().UTC())
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return "", fmt.Errorf("erro no upload para S3: status %d, resposta: %s", res.StatusCode, string(body))
+	}
+
+	if s.PublicURL != "" {
+		return strings.TrimSuffix(s.PublicURL, "/") + "/" + s3EscapePath(key), nil
+	}
+	return objectURL, nil
+}
+
+func (s *S3Storage) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, s.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath codifica cada segmento da chave como exige a assinatura V4.
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+				c == '-' || c == '_' || c == '.' || c == '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// Segredo dos vetores de teste SHA1 do apêndice B da RFC 6238 ("12345678901234567890").
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	// A RFC usa 8 dígitos; com 6, valem os 6 últimos.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode([]byte("12345678901234567890"), tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("totpCode(t=%d) = %s, esperado %s", tt.unix, got, tt.code)
+		}
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(t=%d) = (%d, %v), esperado (%d, true)", tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	const code = "005924" // passo de t=1234567890
+	issued := time.Unix(1234567890, 0)
+
+	tests := []struct {
+		name  string
+		steps int
+		ok    bool
+	}{
+		{"mesmo passo", 0, true},
+		{"um passo depois", 1, true},
+		{"um passo antes", -1, true},
+		{"dois passos depois", 2, false},
+		{"dois passos antes", -2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := issued.Add(time.Duration(tt.steps*totpPeriod) * time.Second)
+			if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok != tt.ok {
+				t.Errorf("ValidateTOTP com %d passos de diferença = %v, esperado %v", tt.steps, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	if _, ok := ValidateTOTP(rfc6238Secret, " 005 924 ", now); !ok {
+		t.Error("código com espaços deveria ser aceito")
+	}
+	for _, code := range []string{"", "05924", "0005924", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+			t.Errorf("código %q não deveria ser aceito", code)
+		}
+	}
+	if _, ok := ValidateTOTP("não é base32!", "005924", now); ok {
+		t.Error("segredo inválido não deveria validar")
+	}
+}
+
+func TestRecoveryCodeFormat(t *testing.T) {
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		code, err := GenerateRecoveryCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !format.MatchString(code) {
+			t.Errorf("código %q fora do formato xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("código %q repetido", code)
+		}
+		seen[code] = true
+
+		if got, want := NormalizeRecoveryCode(" "+code[:3]+" "+code[3:]+" "), code[:5]+code[6:]; got != want {
+			t.Errorf("NormalizeRecoveryCode = %q, esperado %q", got, want)
+		}
+	}
+	if got := NormalizeRecoveryCode("ABCDE-FGHIJ"); got != "abcdefghij" {
+		t.Errorf("NormalizeRecoveryCode em caixa alta = %q", got)
+	}
+}
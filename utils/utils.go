@@ -4,94 +4,147 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	// Embute o banco de fusos horários: imagens sem tzdata não têm America/Sao_Paulo
+	_ "time/tzdata"
 
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
+	"github.com/nicolaslucianob/checkinfp/auth"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var JwtKey = []byte(os.Getenv("JWT_SECRET"))
+var Ctx = context.Background()
 
-func GenerateToken(userID uuid.UUID) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID.String(),
-		"exp":     time.Now().Add(time.Hour * 3).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(JwtKey)
-}
+// SaoPaulo é o fuso dos cultos, usado para saber o dia e o horário dos check-ins.
+var SaoPaulo = mustLoadLocation("America/Sao_Paulo")
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("fuso horário %s indisponível: %v", name, err))
+	}
+	return location
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// NewRedisClient cria o cliente Redis (com pool de conexões) compartilhado pela API.
+// Deve ser chamado uma única vez, na inicialização.
+func NewRedisClient() *redis.Client {
+	options := &redis.Options{
+		Addr:         os.Getenv("REDIS_ADDR"),
+		Password:     os.Getenv("REDIS_PASS"),
+		PoolSize:     EnvInt("REDIS_POOL_SIZE", 20),
+		MinIdleConns: EnvInt("REDIS_MIN_IDLE_CONNS", 2),
+		DialTimeout:  EnvDuration("REDIS_DIAL_TIMEOUT", 5*time.Second),
+		ReadTimeout:  EnvDuration("REDIS_READ_TIMEOUT", 3*time.Second),
+		WriteTimeout: EnvDuration("REDIS_WRITE_TIMEOUT", 3*time.Second),
+		PoolTimeout:  EnvDuration("REDIS_POOL_TIMEOUT", 4*time.Second),
+	}
+	if os.Getenv("REDIS_TLS") != "false" {
+		options.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return redis.NewClient(options)
 }
 
-func InitCloudinary() (*cloudinary.Cloudinary, error) {
-	cld, err := cloudinary.NewFromParams(
-		os.Getenv("CLOUDINARY_CLOUD_NAME"),
-		os.Getenv("CLOUDINARY_API_KEY"),
-		os.Getenv("CLOUDINARY_API_SECRET"),
-	)
+// EnvInt lê um inteiro do ambiente, usando fallback quando ausente ou inválido.
+func EnvInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
 	if err != nil {
-		return nil, err
+		return fallback
 	}
-	return cld, nil
+	return value
 }
 
-func UploadToCloudinary(filePath string, filename string) (string, error) {
-	cld, err := InitCloudinary()
+// EnvDuration lê uma duração (ex.: "3s", "500ms") do ambiente, usando fallback quando ausente ou inválida.
+func EnvDuration(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
 	if err != nil {
-		return "", fmt.Errorf("erro ao inicializar Cloudinary: %v", err)
+		return fallback
 	}
+	return value
+}
 
-	ctx := context.Background()
-	uploadParams := uploader.UploadParams{
-		PublicID: filename,
+// IsDuplicateKeyError indica se o erro do banco é uma violação de restrição única.
+func IsDuplicateKeyError(err error) bool {
+	if err == nil {
+		return false
 	}
+	errMsg := err.Error()
+	return strings.Contains(errMsg, "duplicate key") ||
+		strings.Contains(errMsg, "UNIQUE constraint failed") ||
+		strings.Contains(errMsg, "duplicate entry") ||
+		strings.Contains(errMsg, "Error 1062")
+}
 
-	log.Println("Tentando enviar arquivo:", filePath)
-
-	uploadResult, err := cld.Upload.Upload(ctx, filePath, uploadParams)
+func GenerateRandomToken() string {
+	bytes := make([]byte, 16) // 128 bits
+	_, err := rand.Read(bytes)
 	if err != nil {
-		// return "", fmt.Errorf("erro ao fazer upload para Cloudinary: %v", err)
-		return "", fmt.Errorf("erro no upload para Cloudinary:\nArquivo: %s\nErro: %v", filePath, err)
+		return ""
 	}
+	return hex.EncodeToString(bytes)
+}
 
-	log.Println("Upload concluído. URL:", uploadResult.SecureURL)
-	return uploadResult.SecureURL, nil
+// HashToken retorna o SHA-256 (hex) de um token, para guardá-lo no banco sem o valor original.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-var Ctx = context.Background()
+// SessionRevokedKey marca no cache uma sessão encerrada (logout), até os access
+// tokens dela expirarem.
+func SessionRevokedKey(sessionID string) string {
+	return fmt.Sprintf("checkinfp:session_revoked:%s", sessionID)
+}
 
-func NewRedisClient() *redis.Client {
-	return redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_ADDR"),
-		Password: os.Getenv("REDIS_PASS"),
-		TLSConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		},
-	})
+// UserRevokedBeforeKey guarda o segundo (unix) da revogação de todas as sessões do
+// usuário; access tokens emitidos antes dele deixam de valer.
+func UserRevokedBeforeKey(userID string) string {
+	return fmt.Sprintf("checkinfp:user_revoked_before:%s", userID)
 }
 
-func GenerateRandomToken() string {
-	bytes := make([]byte, 16) // 128 bits
-	_, err := rand.Read(bytes)
+// RotatingQRSecret retorna a chave usada para assinar os QR Codes rotativos:
+// QR_ROTATING_SECRET ou, na falta dela, uma chave derivada da chave JWT ativa.
+// Nunca é vazia depois de CheckRotatingQRSecret passar na inicialização.
+func RotatingQRSecret() []byte {
+	if secret := os.Getenv("QR_ROTATING_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	key, err := auth.DerivedKey("rotating-qr")
 	if err != nil {
-		return ""
+		return nil
 	}
-	return hex.EncodeToString(bytes)
+	return key
+}
+
+// CheckRotatingQRSecret impede a API de subir sem chave para os QR Codes
+// rotativos: com a chave vazia, qualquer um calcularia os códigos.
+func CheckRotatingQRSecret() error {
+	if len(RotatingQRSecret()) == 0 {
+		return fmt.Errorf("chave dos QR Codes rotativos vazia: configure QR_ROTATING_SECRET ou as chaves JWT")
+	}
+	return nil
+}
+
+// RotatingStep retorna o passo de tempo (estilo TOTP) em que t se encontra.
+func RotatingStep(t time.Time, interval time.Duration) int64 {
+	return t.Unix() / int64(interval/time.Second)
+}
+
+// RotatingCode calcula o código do QR rotativo de um evento para um passo de tempo:
+// um HMAC-SHA256 de "<eventID>:<nonce>:<step>", truncado em 16 caracteres
+// hexadecimais. O nonce é sorteado a cada QR gerado, para que os códigos de um QR
+// anterior do mesmo evento não valham mais.
+func RotatingCode(secret []byte, eventID, nonce string, step int64) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s:%s:%d", eventID, nonce, step)
+	return hex.EncodeToString(mac.Sum(nil))[:16]
 }